@@ -0,0 +1,66 @@
+package phase
+
+import (
+	"sort"
+	"sync"
+)
+
+// Coordinator shuts down independent root Phasers, such as the frontend,
+// backend and storage tiers of a program, in a fixed global order.
+// The zero value is ready to use.
+type Coordinator struct {
+	mu    sync.Mutex
+	roots []coordinated
+}
+
+type coordinated struct {
+	name  string
+	root  *Phaser
+	order int
+}
+
+// Register adds root to the Coordinator under name. Roots are shut down in
+// ascending order value, and roots with the same order value together.
+func (c *Coordinator) Register(name string, root *Phaser, order int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roots = append(c.roots, coordinated{name: name, root: root, order: order})
+}
+
+// sorted returns the registered roots in shutdown order.
+func (c *Coordinator) sorted() []coordinated {
+	c.mu.Lock()
+	roots := append([]coordinated(nil), c.roots...)
+	c.mu.Unlock()
+	sort.SliceStable(roots, func(i, j int) bool {
+		return roots[i].order < roots[j].order
+	})
+	return roots
+}
+
+// Order returns the names of the registered roots in the order they are shut
+// down. Roots registered with the same order value are listed in the order
+// they were registered.
+func (c *Coordinator) Order() []string {
+	var names []string
+	for _, r := range c.sorted() {
+		names = append(names, r.name)
+	}
+	return names
+}
+
+// Shutdown cancels the registered roots one order value at a time, waiting
+// for every root with one order value to finish before cancelling those with
+// the next.
+func (c *Coordinator) Shutdown() {
+	roots := c.sorted()
+	for len(roots) > 0 {
+		var group []*Phaser
+		order := roots[0].order
+		for len(roots) > 0 && roots[0].order == order {
+			group = append(group, roots[0].root)
+			roots = roots[1:]
+		}
+		WaitAll(group...)
+	}
+}
@@ -0,0 +1,45 @@
+package phase
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCoordinator(t *testing.T) {
+	var c Coordinator
+	closed := make(chan string, 4)
+	for _, r := range []struct {
+		name  string
+		order int
+	}{{"storage", 3}, {"frontend", 1}, {"backend", 2}, {"cache", 2}} {
+		root := FromContext(context.Background())
+		child := root.Next()
+		name := r.name
+		go func() {
+			<-child.Done()
+			// Give later tiers a chance to close out of turn.
+			time.Sleep(5 * time.Millisecond)
+			closed <- name
+			child.Cancel()
+		}()
+		c.Register(name, root, r.order)
+	}
+
+	expected := []string{"frontend", "backend", "cache", "storage"}
+	if order := c.Order(); !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected order %v but got %v", expected, order)
+	}
+	c.Shutdown()
+	if v := <-closed; v != "frontend" {
+		t.Errorf("Expected frontend to close first but got %s", v)
+	}
+	// backend and cache share an order value and close together.
+	if a, b := <-closed, <-closed; a == "storage" || b == "storage" {
+		t.Errorf("Expected storage to close last but got %s, %s", a, b)
+	}
+	if v := <-closed; v != "storage" {
+		t.Errorf("Expected storage to close last but got %s", v)
+	}
+}
@@ -0,0 +1,54 @@
+package phase
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// childCounter counts the live children of a tier. It is like a
+// sync.WaitGroup, but Wait returns a channel so that waiting can be combined
+// with timeouts and progress reporting, and the count can be read.
+type childCounter struct {
+	n       atomic.Int64
+	waiting atomic.Bool
+	once    sync.Once
+	zero    chan struct{}
+}
+
+func newChildCounter() *childCounter {
+	return &childCounter{zero: make(chan struct{})}
+}
+
+// Add adds one to the count.
+func (c *childCounter) Add() {
+	c.n.Add(1)
+}
+
+// Done subtracts one from the count. It panics if the count goes negative.
+func (c *childCounter) Done() {
+	n := c.n.Add(-1)
+	if n < 0 {
+		panic("phase: negative child count")
+	}
+	// Wait stores waiting before loading the count, and Done stores the
+	// count before loading waiting, so at least one of them sees zero
+	// while waiting and closes the channel.
+	if n == 0 && c.waiting.Load() {
+		c.once.Do(func() { close(c.zero) })
+	}
+}
+
+// Len returns the current count.
+func (c *childCounter) Len() int {
+	return int(c.n.Load())
+}
+
+// Wait returns a channel which is closed once the count is zero. Children
+// are not expected to be added once waiting has begun.
+func (c *childCounter) Wait() <-chan struct{} {
+	c.waiting.Store(true)
+	if c.n.Load() == 0 {
+		c.once.Do(func() { close(c.zero) })
+	}
+	return c.zero
+}
@@ -0,0 +1,73 @@
+package phase
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChildCounterWaitZero(t *testing.T) {
+	c := newChildCounter()
+	select {
+	case <-c.Wait():
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Wait to return immediately with no children")
+	}
+}
+
+func TestChildCounterWait(t *testing.T) {
+	c := newChildCounter()
+	c.Add()
+	c.Add()
+	done := c.Wait()
+	c.Done()
+	select {
+	case <-done:
+		t.Fatalf("Expected Wait to block while a child is outstanding")
+	case <-time.After(10 * time.Millisecond):
+	}
+	c.Done()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Wait to return once all children are done")
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("Expected no children but got %d", n)
+	}
+}
+
+func TestChildCounterNegative(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected Done without Add to panic")
+		}
+	}()
+	newChildCounter().Done()
+}
+
+func TestChildCounterConcurrent(t *testing.T) {
+	// Race the last Done against the start of Wait, so that a lost wakeup
+	// would leave Wait blocked.
+	for i := 0; i < 1000; i++ {
+		c := newChildCounter()
+		const n = 8
+		for j := 0; j < n; j++ {
+			c.Add()
+		}
+		var wg sync.WaitGroup
+		for j := 0; j < n; j++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.Done()
+			}()
+		}
+		select {
+		case <-c.Wait():
+		case <-time.After(time.Second):
+			t.Fatalf("Lost wakeup with %d children outstanding", c.Len())
+		}
+		wg.Wait()
+	}
+}
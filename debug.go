@@ -0,0 +1,35 @@
+package phase
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+var debug int32
+
+// SetDebug enables or disables collection of diagnostic information, such as
+// the stacks reported by WaitStack. It is disabled by default as capturing
+// stacks is expensive.
+func SetDebug(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&debug, v)
+}
+
+func debugEnabled() bool {
+	return atomic.LoadInt32(&debug) == 1
+}
+
+// captureStack returns the stack of the calling goroutine.
+func captureStack() []byte {
+	buf := make([]byte, 4096)
+	for {
+		n := runtime.Stack(buf, false)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
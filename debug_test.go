@@ -0,0 +1,38 @@
+package phase
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestWaitStack(t *testing.T) {
+	SetDebug(true)
+	defer SetDebug(false)
+
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	if p0.WaitStack() != nil {
+		t.Errorf("Expected no stack before cancellation")
+	}
+
+	// p0 waits on p1, which has not yet called Cancel.
+	p0.Cancel()
+	stack := p0.WaitStack()
+	if !bytes.Contains(stack, []byte("TestWaitStack")) {
+		t.Errorf("Expected stack of cancelling goroutine but got %q", stack)
+	}
+	assertContextAlive(t, p0)
+
+	p1.Cancel()
+	<-p0.Done()
+}
+
+func TestWaitStackDisabled(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p0.Cancel()
+	<-p0.Done()
+	if p0.WaitStack() != nil {
+		t.Errorf("Expected no stack with debugging disabled")
+	}
+}
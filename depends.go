@@ -0,0 +1,63 @@
+package phase
+
+import "sync"
+
+// depMu serialises DependsOn so that two calls cannot together form a cycle
+// which neither detects.
+var depMu sync.Mutex
+
+// DependsOn records that the Phaser depends on other, which may be in a
+// different tree, so that other's context does not end until the Phaser's
+// has. Subsystems whose dependencies form a DAG rather than a tree can then
+// shut down in a valid order: other is cancelled as usual, but waits for the
+// Phaser as if it were one of its children. ErrDependencyCycle is returned if
+// the Phaser already waits for other, because other is one of its
+// descendants or depends on it directly or transitively, and ErrPhaseClosed
+// if other's context has ended.
+func (p *Phaser) DependsOn(other *Phaser) error {
+	depMu.Lock()
+	defer depMu.Unlock()
+	if waitsFor(p, other, make(map[*Phaser]bool)) {
+		return ErrDependencyCycle
+	}
+	if err := other.HoldOpen(); err != nil {
+		return err
+	}
+	other.mu.Lock()
+	if other.dependents == nil {
+		other.dependents = make(map[*Phaser]struct{})
+	}
+	other.dependents[p] = struct{}{}
+	other.mu.Unlock()
+	p.AfterDone(func() {
+		other.mu.Lock()
+		delete(other.dependents, p)
+		other.mu.Unlock()
+		other.Release()
+	})
+	return nil
+}
+
+// waitsFor reports whether the context of p cannot end until that of q has,
+// because q is a descendant of p or depends on p, directly or transitively.
+func waitsFor(p, q *Phaser, seen map[*Phaser]bool) bool {
+	if p == q {
+		return true
+	}
+	if seen[p] {
+		return false
+	}
+	seen[p] = true
+	p.mu.Lock()
+	next := p.liveChildrenLocked()
+	for d := range p.dependents {
+		next = append(next, d)
+	}
+	p.mu.Unlock()
+	for _, n := range next {
+		if waitsFor(n, q, seen) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package phase
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDependsOnDiamond(t *testing.T) {
+	// cache depends on db and config, and app depends on cache. Each is a
+	// separate root, all cancelled at once.
+	db := FromContext(context.Background())
+	config := FromContext(context.Background())
+	cache := FromContext(context.Background())
+	app := FromContext(context.Background())
+	for _, dep := range []struct{ p, on *Phaser }{
+		{cache, db}, {cache, config}, {app, cache},
+	} {
+		if err := dep.p.DependsOn(dep.on); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// Each Phaser must only end once everything depending on it has.
+	check := func(p *Phaser, dependents ...*Phaser) chan struct{} {
+		checked := make(chan struct{})
+		go func() {
+			defer close(checked)
+			<-p.Done()
+			for _, d := range dependents {
+				assertContextFinished(t, d)
+			}
+		}()
+		return checked
+	}
+	checks := []chan struct{}{
+		check(db, cache, app),
+		check(config, cache, app),
+		check(cache, app),
+	}
+
+	for _, p := range []*Phaser{db, config, cache, app} {
+		p.Cancel()
+	}
+	time.Sleep(10 * time.Millisecond)
+	for _, c := range checks {
+		select {
+		case <-c:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected all Phasers to finish")
+		}
+	}
+}
+
+func TestDependsOnWaits(t *testing.T) {
+	db := FromContext(context.Background())
+	cache := FromContext(context.Background())
+	if err := cache.DependsOn(db); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	db.Cancel()
+	time.Sleep(10 * time.Millisecond)
+	assertContextAlive(t, db)
+
+	cache.Cancel()
+	<-db.Done()
+}
+
+func TestDependsOnCycle(t *testing.T) {
+	a := FromContext(context.Background())
+	b := FromContext(context.Background())
+	c := FromContext(context.Background())
+	defer func() {
+		a.Cancel()
+		b.Cancel()
+		c.Cancel()
+	}()
+	if err := a.DependsOn(b); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := b.DependsOn(c); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := c.DependsOn(a); err != ErrDependencyCycle {
+		t.Errorf("Expected ErrDependencyCycle but got %v", err)
+	}
+	if err := a.DependsOn(a); err != ErrDependencyCycle {
+		t.Errorf("Expected ErrDependencyCycle depending on itself but got %v", err)
+	}
+}
+
+func TestDependsOnDescendant(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p1.AutoClose()
+	defer p0.Cancel()
+	// p0 already waits for its child p1.
+	if err := p0.DependsOn(p1); err != ErrDependencyCycle {
+		t.Errorf("Expected ErrDependencyCycle but got %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+package phase
+
+import "errors"
+
+// IsPhaseClosed reports whether err is, or wraps, ErrPhaseClosed.
+func IsPhaseClosed(err error) bool {
+	return errors.Is(err, ErrPhaseClosed)
+}
+
+// IsShutdownTimeout reports whether err is, or wraps, ErrShutdownTimeout.
+func IsShutdownTimeout(err error) bool {
+	return errors.Is(err, ErrShutdownTimeout)
+}
@@ -0,0 +1,29 @@
+package phase
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrorHelpers(t *testing.T) {
+	for _, tc := range []struct {
+		err             error
+		closed, timeout bool
+	}{
+		{ErrPhaseClosed, true, false},
+		{fmt.Errorf("stopping: %w", ErrPhaseClosed), true, false},
+		{ErrShutdownTimeout, false, true},
+		{fmt.Errorf("stopping: %w", ErrShutdownTimeout), false, true},
+		{ErrParentClosing, false, false},
+		{errors.New("phase: phaser is closed"), false, false},
+		{nil, false, false},
+	} {
+		if v := IsPhaseClosed(tc.err); v != tc.closed {
+			t.Errorf("IsPhaseClosed(%v) = %v, expected %v", tc.err, v, tc.closed)
+		}
+		if v := IsShutdownTimeout(tc.err); v != tc.timeout {
+			t.Errorf("IsShutdownTimeout(%v) = %v, expected %v", tc.err, v, tc.timeout)
+		}
+	}
+}
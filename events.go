@@ -0,0 +1,155 @@
+package phase
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType identifies a lifecycle transition reported in a PhaseEvent.
+type EventType int
+
+const (
+	// EventCreated is emitted when a Phaser is created or Reset.
+	EventCreated EventType = iota
+	// EventCanceled is emitted when a Phaser begins cancellation.
+	EventCanceled
+	// EventChildrenDrained is emitted once a cancelled Phaser has stopped
+	// waiting for its children.
+	EventChildrenDrained
+	// EventClosed is emitted once a Phaser has closed.
+	EventClosed
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventCreated:
+		return "created"
+	case EventCanceled:
+		return "canceled"
+	case EventChildrenDrained:
+		return "children drained"
+	case EventClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// PhaseEvent is a lifecycle transition of a Phaser, delivered by Events.
+type PhaseEvent struct {
+	Name string
+	Type EventType
+	Time time.Time
+}
+
+// EventsOption configures a subscription made with Events.
+type EventsOption func(*subscription)
+
+// WithEventBuffer sets the number of events buffered for a slow consumer.
+// The default is 16.
+func WithEventBuffer(n int) EventsOption {
+	return func(s *subscription) {
+		s.buffer = n
+	}
+}
+
+// WithBlockingEvents makes delivery wait for the consumer rather than drop
+// events when the buffer is full. A slow consumer then delays the Phasers
+// emitting events, including callers of Cancel.
+func WithBlockingEvents() EventsOption {
+	return func(s *subscription) {
+		s.block = true
+	}
+}
+
+// WithDescendantEvents includes the events of the Phaser's descendants as
+// well as its own.
+func WithDescendantEvents() EventsOption {
+	return func(s *subscription) {
+		s.descendants = true
+	}
+}
+
+// subscription is a consumer of events registered with Events.
+type subscription struct {
+	buffer      int
+	block       bool
+	descendants bool
+
+	mu     sync.Mutex
+	ch     chan PhaseEvent
+	closed bool
+}
+
+// Events returns a channel of the Phaser's lifecycle events, for example to
+// render a timeline of shutdown. The channel is closed after the Phaser's
+// EventClosed event. By default events which do not fit in the buffer are
+// dropped, so a slow consumer cannot hold up the Phaser, and counted by
+// DroppedEvents.
+func (p *Phaser) Events(opts ...EventsOption) <-chan PhaseEvent {
+	s := &subscription{buffer: 16}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.ch = make(chan PhaseEvent, s.buffer)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.subs = append(p.subs, s)
+	return s.ch
+}
+
+// emit delivers an event of type t to the subscribers of the Phaser, and of
+// its ancestors which asked for descendant events. After EventClosed the
+// Phaser's own subscriptions end.
+func (p *Phaser) emit(t EventType) {
+	e := PhaseEvent{Name: p.Name(), Type: t, Time: time.Now()}
+	for a := p; a != nil; a = a.parent {
+		a.mu.Lock()
+		subs := append([]*subscription(nil), a.subs...)
+		if a == p && t == EventClosed {
+			a.subs = nil
+		}
+		a.mu.Unlock()
+		for _, s := range subs {
+			if (a == p || s.descendants) && !s.send(e) {
+				a.dropped.Add(1)
+			}
+			if a == p && t == EventClosed {
+				s.close()
+			}
+		}
+	}
+}
+
+// DroppedEvents returns the number of events which did not fit in the buffer
+// of a subscription to the Phaser's Events, and so were never delivered. A
+// monitor can use it to tell when it is missing part of a shutdown.
+func (p *Phaser) DroppedEvents() uint64 {
+	return p.dropped.Load()
+}
+
+// send delivers e to the subscriber, reporting false if it was dropped.
+func (s *subscription) send(e PhaseEvent) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return true
+	}
+	if s.block {
+		s.ch <- e
+		return true
+	}
+	select {
+	case s.ch <- e:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	close(s.ch)
+}
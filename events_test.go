@@ -0,0 +1,77 @@
+package phase
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func collectEvents(ch <-chan PhaseEvent) []string {
+	var events []string
+	for e := range ch {
+		events = append(events, e.Name+" "+e.Type.String())
+	}
+	return events
+}
+
+func TestEvents(t *testing.T) {
+	p0 := FromContext(context.Background(), WithName("root"))
+	events := p0.Events()
+	p1 := p0.Next(WithName("child"))
+	p1.AutoClose()
+	p0.Cancel()
+
+	expected := []string{"root canceled", "root children drained", "root closed"}
+	if got := collectEvents(events); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected events %v but got %v", expected, got)
+	}
+}
+
+func TestEventsDescendants(t *testing.T) {
+	p0 := FromContext(context.Background(), WithName("root"))
+	events := p0.Events(WithDescendantEvents(), WithBlockingEvents())
+	p1 := p0.Next(WithName("child"))
+	p1.AutoClose()
+	p0.Cancel()
+
+	expected := []string{
+		"child created",
+		"root canceled",
+		"child canceled",
+		"child children drained",
+		"child closed",
+		"root children drained",
+		"root closed",
+	}
+	if got := collectEvents(events); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected events %v but got %v", expected, got)
+	}
+}
+
+func TestEventsSlowConsumer(t *testing.T) {
+	p0 := FromContext(context.Background())
+	// Nothing reads the events.
+	p0.Events(WithDescendantEvents(), WithEventBuffer(1))
+	var children []*Phaser
+	for i := 0; i < 10; i++ {
+		p := p0.Next()
+		p.AutoClose()
+		children = append(children, p)
+	}
+	p0.Cancel()
+	select {
+	case <-p0.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a slow consumer not to hold up shutdown")
+	}
+	// A child's closed event may follow the root being done.
+	for _, p := range children {
+		<-p.closedCh
+	}
+	// Each child emits 4 events and the root 2 before it is done, of
+	// which only one fits in the buffer.
+	if n := p0.DroppedEvents(); n < 41 {
+		t.Errorf("Expected at least 41 dropped events but got %d", n)
+	}
+}
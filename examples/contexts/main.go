@@ -12,6 +12,9 @@ import (
 	"github.com/aelse/phase"
 )
 
+// goroutineKey is the context key under which each goroutine's number is stored.
+type goroutineKey struct{}
+
 func main() {
 	// Create a top lever phaser which will be cancelled at end of main.
 	phaser := phase.FromContext(context.Background())
@@ -24,9 +27,9 @@ func main() {
 		// Run some other goroutines which take an ordinary context.
 		for i := 0; i < 5; i++ {
 			// Phasers can be used like any other context. Let's set a value.
-			ctx := context.WithValue(p1, "goroutine", i)
+			ctx := phase.WithValue(p1, goroutineKey{}, i)
 			go func(ctx context.Context) {
-				num := ctx.Value("goroutine").(int)
+				num, _ := phase.Value[int](ctx, goroutineKey{})
 				fmt.Printf("goroutine(%d) started\n", num)
 				<-ctx.Done()
 				fmt.Printf("goroutine(%d) finished\n", num)
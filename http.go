@@ -0,0 +1,38 @@
+package phase
+
+import (
+	"context"
+	"net/http"
+)
+
+// Middleware returns a handler which runs each request to next in its own
+// child of the Phaser found in the request context, for example one set as
+// the server's BaseContext. Cancelling that Phaser then waits for in-flight
+// requests to complete. The child is cancelled if the request context ends,
+// and closed when next returns, even if it panics.
+// Requests whose context holds no Phaser are passed to next unchanged.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent := ancestor(r.Context())
+		if parent == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var cancel context.CancelCauseFunc
+		p := parent.next(0, []Option{withValues(r.Context())}, func(ctx context.Context) context.Context {
+			ctx, cancel = context.WithCancelCause(ctx)
+			spawn(func() {
+				select {
+				case <-r.Context().Done():
+					cancel(context.Cause(r.Context()))
+				case <-ctx.Done():
+				}
+			})
+			return ctx
+		})
+		defer cancel(nil)
+		defer p.Cancel()
+		next.ServeHTTP(w, r.WithContext(p))
+	})
+}
@@ -0,0 +1,56 @@
+package phase
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	root := New()
+	started := make(chan struct{})
+	var finished int32
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Value(http.ServerContextKey).(*http.Server); !ok {
+			t.Errorf("Expected request values to be preserved")
+		}
+		close(started)
+		time.Sleep(20 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+	})
+
+	srv := httptest.NewUnstartedServer(Middleware(handler))
+	srv.Config.BaseContext = func(net.Listener) context.Context { return root }
+	srv.Start()
+	defer srv.Close()
+
+	go func() {
+		resp, err := http.Get(srv.URL)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-started
+
+	// Shutdown blocks until the in-flight request completes.
+	root.CancelAndWait()
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Errorf("Expected shutdown to wait for in-flight request")
+	}
+}
+
+func TestMiddlewareWithoutPhaser(t *testing.T) {
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	Middleware(handler).ServeHTTP(httptest.NewRecorder(), req)
+	if !called {
+		t.Errorf("Expected handler to be called")
+	}
+}
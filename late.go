@@ -0,0 +1,46 @@
+package phase
+
+import "sync/atomic"
+
+// LateChildPolicy is what happens when a child closes after its parent has
+// stopped waiting for it, because of ForceClose or a shutdown deadline set by
+// NextWithShutdownDeadline. The parent's count of children is unaffected by
+// the policy.
+type LateChildPolicy int32
+
+const (
+	// LateChildIgnore ignores a late child. It is the default.
+	LateChildIgnore LateChildPolicy = iota
+	// LateChildLog logs a warning with the Logger of the child.
+	LateChildLog
+	// LateChildPanic panics, to catch a subsystem which overruns its
+	// shutdown deadline during development.
+	LateChildPanic
+)
+
+var lateChildPolicy int32
+
+// SetLateChildPolicy sets the policy applied to a child which closes after
+// its parent has stopped waiting for it.
+func SetLateChildPolicy(policy LateChildPolicy) {
+	atomic.StoreInt32(&lateChildPolicy, int32(policy))
+}
+
+// lateChild applies the late child policy to child of p.
+func (p *Phaser) lateChild(child *Phaser) {
+	switch LateChildPolicy(atomic.LoadInt32(&lateChildPolicy)) {
+	case LateChildLog:
+		Logger(child).Warn("phase: child closed after its parent stopped waiting",
+			"parent", p.label(), "child", child.label())
+	case LateChildPanic:
+		panic("phase: child " + child.label() + " closed after its parent " + p.label() + " stopped waiting")
+	}
+}
+
+// WasOrphaned reports whether the Phaser's parent abandoned it with
+// ForceClose, so that it can report that nothing is waiting for it to close.
+func (p *Phaser) WasOrphaned() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.orphaned
+}
@@ -0,0 +1,142 @@
+package phase
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recoveringScheduler reports panics in the package's goroutines rather than
+// crashing the test binary.
+type recoveringScheduler struct {
+	panics chan any
+}
+
+func (s recoveringScheduler) Go(fn func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.panics <- r
+			}
+		}()
+		fn()
+	}()
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLateChildIgnore(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p0.ForceClose()
+	<-p0.Done()
+
+	// The late close must not drive the count of children negative.
+	p1.Cancel()
+	<-p1.closedCh
+	if n := len(p0.liveChildren()); n != 0 {
+		t.Errorf("Expected no children but got %d", n)
+	}
+}
+
+func TestWasOrphaned(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p2 := p0.Next()
+	p2.Cancel()
+	<-p2.closedCh
+	if p1.WasOrphaned() {
+		t.Errorf("Expected p1 not to be orphaned before ForceClose")
+	}
+
+	p0.ForceClose()
+	p1.Cancel()
+	<-p1.closedCh
+	if !p1.WasOrphaned() {
+		t.Errorf("Expected p1 to be orphaned by ForceClose")
+	}
+	if p2.WasOrphaned() {
+		t.Errorf("Expected p2 which closed first not to be orphaned")
+	}
+	<-p0.Done()
+}
+
+func TestLateChildLog(t *testing.T) {
+	SetLateChildPolicy(LateChildLog)
+	defer SetLateChildPolicy(LateChildIgnore)
+	var buf syncBuffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	p0 := FromContext(context.Background())
+	p1 := p0.NextWithShutdownDeadline(10 * time.Millisecond)
+	p1.AutoClose()
+	p2 := p1.NextWithLogger(logger)
+	p0.Cancel()
+	<-p1.Done()
+
+	p2.Cancel()
+	<-p2.closedCh
+	if !strings.Contains(buf.String(), "child closed after its parent stopped waiting") {
+		t.Errorf("Expected the late child to be logged but got %q", buf.String())
+	}
+	<-p0.Done()
+}
+
+func TestForceCloseLog(t *testing.T) {
+	var buf syncBuffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	p0 := FromContext(context.Background())
+	p1 := p0.NextWithLogger(logger)
+	p2 := p1.Next(WithName("stuck"))
+	p1.ForceClose()
+	<-p1.Done()
+	if out := buf.String(); !strings.Contains(out, "child abandoned by ForceClose") || !strings.Contains(out, "stuck") {
+		t.Errorf("Expected the abandoned child to be logged but got %q", out)
+	}
+	p2.Cancel()
+	p0.Cancel()
+}
+
+func TestLateChildPanic(t *testing.T) {
+	SetLateChildPolicy(LateChildPanic)
+	defer SetLateChildPolicy(LateChildIgnore)
+	s := recoveringScheduler{panics: make(chan any, 1)}
+	SetScheduler(s)
+	defer SetScheduler(nil)
+
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p0.ForceClose()
+	<-p0.Done()
+
+	p1.Cancel()
+	select {
+	case r := <-s.panics:
+		if msg, _ := r.(string); !strings.Contains(msg, "stopped waiting") {
+			t.Errorf("Unexpected panic %v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the late child to panic")
+	}
+}
@@ -0,0 +1,60 @@
+package phase
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+// live tracks the Phasers started while debugging is enabled, for
+// AssertNoLeaks.
+var live struct {
+	sync.Mutex
+	phasers map[*Phaser]struct{}
+}
+
+// track records a started Phaser if debugging is enabled.
+func track(p *Phaser) {
+	if !debugEnabled() {
+		return
+	}
+	live.Lock()
+	defer live.Unlock()
+	if live.phasers == nil {
+		live.phasers = make(map[*Phaser]struct{})
+	}
+	live.phasers[p] = struct{}{}
+}
+
+// untrack forgets a closed Phaser.
+func untrack(p *Phaser) {
+	live.Lock()
+	defer live.Unlock()
+	delete(live.phasers, p)
+}
+
+// AssertNoLeaks fails t if any Phaser started while debugging was enabled (see
+// SetDebug) has not had Cancel, or one of its variants, called. Leaked Phasers
+// are reported once and then forgotten. Typical use in a test is:
+//
+//	phase.SetDebug(true)
+//	defer phase.SetDebug(false)
+//	defer phase.AssertNoLeaks(t)
+func AssertNoLeaks(t testing.TB) {
+	t.Helper()
+	var leaked []string
+	live.Lock()
+	for p := range live.phasers {
+		p.mu.Lock()
+		cancelled := p.cancelled
+		p.mu.Unlock()
+		if !cancelled {
+			leaked = append(leaked, p.label())
+			delete(live.phasers, p)
+		}
+	}
+	live.Unlock()
+	if len(leaked) > 0 {
+		t.Errorf("phase: %d Phaser(s) not cancelled: %s", len(leaked), strings.Join(leaked, ", "))
+	}
+}
@@ -0,0 +1,55 @@
+package phase
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// fakeTB records the failures reported to it.
+type fakeTB struct {
+	testing.TB
+	errors []string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertNoLeaks(t *testing.T) {
+	SetDebug(true)
+	defer SetDebug(false)
+
+	p0 := FromContext(context.Background(), WithName("root"))
+	p0.Next(WithName("child")).AutoClose()
+	p0.CancelAndWait()
+	AssertNoLeaks(t)
+	<-p0.closedCh
+}
+
+func TestAssertNoLeaksFindsLeak(t *testing.T) {
+	SetDebug(true)
+	defer SetDebug(false)
+
+	p0 := FromContext(context.Background(), WithName("leaked"))
+	tb := &fakeTB{}
+	AssertNoLeaks(tb)
+	if len(tb.errors) != 1 {
+		t.Fatalf("Expected the leak to be reported but got %q", tb.errors)
+	}
+	expected := "phase: 1 Phaser(s) not cancelled: leaked"
+	if tb.errors[0] != expected {
+		t.Errorf("Expected %q but got %q", expected, tb.errors[0])
+	}
+
+	// The leak is only reported once.
+	tb = &fakeTB{}
+	AssertNoLeaks(tb)
+	if len(tb.errors) != 0 {
+		t.Errorf("Expected no further leaks but got %q", tb.errors)
+	}
+	p0.CancelAndWait()
+	<-p0.closedCh
+}
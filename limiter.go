@@ -0,0 +1,28 @@
+package phase
+
+// Limiter creates children of a Phaser while bounding how many are live at
+// once, for fan-out which would otherwise create thousands of Phasers.
+type Limiter struct {
+	parent *Phaser
+	slots  chan struct{}
+}
+
+// NextLimiter returns a Limiter which creates children of the Phaser, with at
+// most maxConcurrent of them live at once.
+func (p *Phaser) NextLimiter(maxConcurrent int) *Limiter {
+	return &Limiter{parent: p, slots: make(chan struct{}, maxConcurrent)}
+}
+
+// Next is like Next on the Limiter's Phaser, but first blocks until fewer than
+// the maximum number of children created by the Limiter are live. A child
+// stops counting towards the limit once it has closed.
+func (l *Limiter) Next(opts ...Option) *Phaser {
+	l.slots <- struct{}{}
+	child := l.parent.Next(opts...)
+	closed := child.closedCh
+	spawn(func() {
+		<-closed
+		<-l.slots
+	})
+	return child
+}
@@ -0,0 +1,41 @@
+package phase
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	p0 := FromContext(context.Background())
+	l := p0.NextLimiter(3)
+
+	var mu sync.Mutex
+	live, maxLive := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		p := l.Next()
+		mu.Lock()
+		live++
+		if live > maxLive {
+			maxLive = live
+		}
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(5 * time.Millisecond)
+			// Leave before closing, since the limiter counts closed children.
+			mu.Lock()
+			live--
+			mu.Unlock()
+			p.Cancel()
+		}()
+	}
+	wg.Wait()
+	if maxLive != 3 {
+		t.Errorf("Expected at most 3 live children but got %d", maxLive)
+	}
+	p0.CancelAndWait()
+}
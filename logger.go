@@ -0,0 +1,32 @@
+package phase
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NextWithLogger is like Next but the child carries l, which is returned by
+// Logger for the child and its descendants. This lets separate trees of
+// subsystems log to different destinations.
+func (p *Phaser) NextWithLogger(l *slog.Logger, opts ...Option) *Phaser {
+	return p.next(0, append([]Option{withLogger(l)}, opts...), nil)
+}
+
+// withLogger sets the logger returned by Logger.
+func withLogger(l *slog.Logger) Option {
+	return func(p *Phaser) {
+		p.logger = l
+	}
+}
+
+// Logger returns the logger given to the nearest Phaser in ctx with
+// NextWithLogger, or inherited by it from its parents. It returns
+// slog.Default() if there is none.
+func Logger(ctx context.Context) *slog.Logger {
+	for p := ancestor(ctx); p != nil; p = p.parent {
+		if p.logger != nil {
+			return p.logger
+		}
+	}
+	return slog.Default()
+}
@@ -0,0 +1,38 @@
+package phase
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, nil))
+	root := FromContext(context.Background())
+	web := root.NextWithLogger(l)
+	handler := web.Next()
+
+	Logger(context.WithValue(handler, testKey{}, "x")).Info("draining")
+	if !strings.Contains(buf.String(), "msg=draining") {
+		t.Errorf("Expected message logged to the inherited logger but got %q", buf.String())
+	}
+
+	// A descendant may set its own.
+	other := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	if got := Logger(handler.NextWithLogger(other).Next()); got != other {
+		t.Errorf("Expected the nearest logger to be returned")
+	}
+}
+
+func TestLoggerDefault(t *testing.T) {
+	root := FromContext(context.Background())
+	if l := Logger(root.Next()); l != slog.Default() {
+		t.Errorf("Expected slog.Default() without a logger")
+	}
+	if l := Logger(context.Background()); l != slog.Default() {
+		t.Errorf("Expected slog.Default() without a phaser")
+	}
+}
@@ -0,0 +1,43 @@
+package phase
+
+import (
+	"sync"
+	"time"
+)
+
+// Observer receives notifications of Phaser lifecycle transitions, for
+// example to record metrics of shutdown latency per subsystem.
+// Methods may be called concurrently from multiple goroutines.
+type Observer interface {
+	// PhaseStarted is called when a Phaser is created.
+	PhaseStarted(name string)
+	// PhaseCanceled is called when a Phaser begins cancellation, either
+	// from Cancel or because its parent context ended.
+	PhaseCanceled(name string)
+	// PhaseClosed is called once a cancelled Phaser's context has finished and
+	// Cancel has been called on it. shutdownDuration is the time since
+	// cancellation began.
+	PhaseClosed(name string, shutdownDuration time.Duration)
+	// PhaseCompleted is called in place of PhaseClosed for a Phaser that
+	// finished its work and called Complete before any cancellation.
+	PhaseCompleted(name string, shutdownDuration time.Duration)
+}
+
+var (
+	observerMu sync.RWMutex
+	observer   Observer
+)
+
+// SetObserver sets the Observer notified of lifecycle transitions of all
+// Phasers. Passing nil disables notifications.
+func SetObserver(o Observer) {
+	observerMu.Lock()
+	defer observerMu.Unlock()
+	observer = o
+}
+
+func currentObserver() Observer {
+	observerMu.RLock()
+	defer observerMu.RUnlock()
+	return observer
+}
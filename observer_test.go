@@ -0,0 +1,128 @@
+package phase
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeObserver struct {
+	mu        sync.Mutex
+	started   []string
+	canceled  []string
+	closed    []string
+	completed []string
+	durations map[string]time.Duration
+}
+
+func (o *fakeObserver) PhaseStarted(name string) {
+	if name == "" {
+		return // Ignore Phasers from other tests.
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.started = append(o.started, name)
+}
+
+func (o *fakeObserver) PhaseCanceled(name string) {
+	if name == "" {
+		return // Ignore Phasers from other tests.
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.canceled = append(o.canceled, name)
+}
+
+func (o *fakeObserver) PhaseClosed(name string, d time.Duration) {
+	if name == "" {
+		return // Ignore Phasers from other tests.
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = append(o.closed, name)
+	if o.durations == nil {
+		o.durations = make(map[string]time.Duration)
+	}
+	o.durations[name] = d
+}
+
+func (o *fakeObserver) PhaseCompleted(name string, d time.Duration) {
+	if name == "" {
+		return // Ignore Phasers from other tests.
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.completed = append(o.completed, name)
+}
+
+func TestObserver(t *testing.T) {
+	o := &fakeObserver{}
+	SetObserver(o)
+	defer SetObserver(nil)
+
+	p0 := FromContext(context.Background(), WithName("p0"))
+	p1 := p0.Next(WithName("p1"))
+	go func() {
+		<-p1.Done()
+		time.Sleep(20 * time.Millisecond)
+		p1.Cancel()
+	}()
+
+	p0.Cancel()
+	// The Observer is notified before closedCh is closed.
+	<-p1.closedCh
+	<-p0.closedCh
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.started) != 2 || o.started[0] != "p0" || o.started[1] != "p1" {
+		t.Errorf("Unexpected started notifications %v", o.started)
+	}
+	if len(o.canceled) != 2 || o.canceled[0] != "p0" {
+		t.Errorf("Unexpected canceled notifications %v", o.canceled)
+	}
+	if len(o.closed) != 2 || o.closed[0] != "p1" || o.closed[1] != "p0" {
+		t.Errorf("Unexpected closed notifications %v", o.closed)
+	}
+	if d := o.durations["p0"]; d < 20*time.Millisecond || d > time.Second {
+		t.Errorf("Implausible shutdown duration for p0: %v", d)
+	}
+}
+
+func TestObserverCompleted(t *testing.T) {
+	o := &fakeObserver{}
+	SetObserver(o)
+	defer SetObserver(nil)
+
+	p0 := FromContext(context.Background(), WithName("p0"))
+	workers := []*Phaser{
+		p0.Next(WithName("done1")),
+		p0.Next(WithName("done2")),
+		p0.Next(WithName("interrupted")),
+	}
+	// Two workers finish their work before shutdown.
+	workers[0].Complete()
+	workers[1].Complete()
+	<-workers[0].closedCh
+	<-workers[1].closedCh
+
+	// The remaining worker is interrupted by shutdown.
+	go func() {
+		<-workers[2].Done()
+		workers[2].Cancel()
+	}()
+	p0.Cancel()
+	// The Observer is notified before closedCh is closed.
+	<-workers[2].closedCh
+	<-p0.closedCh
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.completed) != 2 {
+		t.Errorf("Expected 2 completed phases but got %v", o.completed)
+	}
+	if len(o.closed) != 2 {
+		t.Errorf("Expected 2 cancelled phases but got %v", o.closed)
+	}
+}
@@ -2,97 +2,1187 @@ package phase
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-func FromContext(ctx context.Context) *Phaser {
-	phaser := &Phaser{}
+var (
+	// ErrMaxDepthExceeded is returned by NextLimited when creating a child would
+	// exceed the maximum depth.
+	ErrMaxDepthExceeded = errors.New("phase: maximum depth exceeded")
+	// ErrParentClosing is returned when a Phaser cannot be registered with a
+	// parent which has begun cancellation.
+	ErrParentClosing = errors.New("phase: parent is closing")
+	// ErrNotClosed is returned by Reset when the Phaser has not been closed.
+	ErrNotClosed = errors.New("phase: phaser is not closed")
+	// ErrPhaseClosed is returned by HoldOpen once a Phaser's context has
+	// ended.
+	ErrPhaseClosed = errors.New("phase: phaser is closed")
+	// ErrShutdownTimeout is the cause reported by children which were still
+	// waiting to be cancelled when their parent's shutdown timeout expired.
+	ErrShutdownTimeout = errors.New("phase: shutdown timeout")
+	// ErrNoPhaser is returned by RegisterCleanup and NextAny when no context
+	// was derived from a Phaser.
+	ErrNoPhaser = errors.New("phase: no phaser in context")
+	// ErrDependencyCycle is returned by DependsOn when the dependency would
+	// make Phasers wait for each other.
+	ErrDependencyCycle = errors.New("phase: dependency cycle")
+
+	// errPrepared is returned by addChild when PrepareShutdown has been
+	// called but cancellation has not begun.
+	errPrepared = errors.New("phase: parent is prepared for shutdown")
+)
+
+func FromContext(ctx context.Context, opts ...Option) *Phaser {
+	phaser := newPhaser(opts)
 	phaser.init(ctx)
+	phaser.started()
 	return phaser
 }
 
-func New() *Phaser {
-	return FromContext(context.Background())
+func New(opts ...Option) *Phaser {
+	return FromContext(context.Background(), opts...)
+}
+
+func newPhaser(opts []Option) *Phaser {
+	phaser := &Phaser{weight: 1, createdAt: time.Now()}
+	phaser.holdCond.L = &phaser.mu
+	if debugEnabled() {
+		phaser.createStack = captureStack()
+	}
+	for _, opt := range opts {
+		opt(phaser)
+	}
+	return phaser
 }
 
 type Phaser struct {
 	pctx       context.Context
+	vctx       context.Context
 	ctx        context.Context
-	cancel     context.CancelFunc
+	cancel     context.CancelCauseFunc
 	dcancel    context.CancelFunc
-	chldCtx    context.Context
-	chldCancel context.CancelFunc
 	cancelOnce sync.Once
-	tellParent func()
-	children   sync.WaitGroup
+	parent     *Phaser
+	depth      int
+	priority   int
+	weight     int
+
+	shutdownTimeout time.Duration
+	createdAt       time.Time
+	createStack     []byte
+
+	name    string
+	reason  string
+	traceID string
+	logger  *slog.Logger
+
+	dropped atomic.Uint64 // Events dropped by subscriptions.
+
+	mu          sync.Mutex
+	tiers       []*tier
+	kids        map[*Phaser]uint64 // Live children and their creation sequence.
+	kidSeq      uint64
+	abandoned   map[*Phaser]struct{} // Children abandoned by ForceClose.
+	gaveUp      bool                 // The shutdown timeout expired.
+	orphaned    bool                 // Abandoned by the parent's ForceClose.
+	waitStack   []byte
+	canceling   bool
+	prepared    bool
+	draining    bool
+	suspended   bool
+	strictLIFO  bool
+	suspendCh   chan struct{}
+	canceledAt  time.Time
+	cause       error
+	endReason   EndReason
+	completed   bool
+	cancelled   bool
+	cancelText  string
+	drained     chan struct{}
+	closedCh    chan struct{}
+	locals      map[any]any
+	subs        []*subscription
+	holds       int
+	holdCond    sync.Cond
+	lastCh      chan struct{}
+	lastFired   bool
+	dependents  map[*Phaser]struct{}
+	treeDrained []func()
+	ending      bool
+}
+
+// tier is a group of children with the same priority, which are cancelled
+// together during shutdown.
+type tier struct {
+	priority int
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	children *childCounter
+}
+
+// Option configures a new Phaser.
+type Option func(*Phaser)
+
+// WithName names a Phaser, identifying it to an Observer.
+func WithName(name string) Option {
+	return func(p *Phaser) {
+		p.name = name
+	}
+}
+
+// WithReason records why a child Phaser was registered, such as the
+// connection or task it serves. It is reported by RegistrationReason.
+func WithReason(reason string) Option {
+	return func(p *Phaser) {
+		p.reason = reason
+	}
 }
 
 func (p *Phaser) init(ctx context.Context) {
-	// Keep parent context which we need for calls to Value.
+	// Keep parent context which we need for calls to Value, unless values
+	// are to come from elsewhere.
 	p.pctx = ctx
+	if p.vctx == nil {
+		p.vctx = ctx
+	}
+	p.initContexts()
+
+	if p.pctx.Done() == nil {
+		// The parent context can never end, so there is nothing to watch.
+		return
+	}
+	// When parent ctx ends we cancel all downstream Phasers and then our own context.
+	// This preserves ordering in that all children terminate before our context ends.
+	spawn(func() {
+		<-p.pctx.Done()
+		cause := context.Cause(p.pctx)
+		reason := ReasonParentCanceled
+		// A deadline further up the tree reaches us as the cause with which
+		// our parent cancelled its children.
+		if p.pctx.Err() == context.DeadlineExceeded || errors.Is(cause, context.DeadlineExceeded) {
+			reason = ReasonDeadline
+		}
+		p.doCancel(cause, reason)
+	})
+}
+
+// started notifies the Observer that the Phaser has been created.
+func (p *Phaser) started() {
+	track(p)
+	if o := currentObserver(); o != nil {
+		o.PhaseStarted(p.Name())
+	}
+	p.emit(EventCreated)
+}
+
+// withValues makes a Phaser take values from ctx rather than the context
+// which cancels it.
+func withValues(ctx context.Context) Option {
+	return func(p *Phaser) {
+		p.vctx = ctx
+	}
+}
+
+// initContexts creates the Phaser's own contexts from its parent context.
+func (p *Phaser) initContexts() {
 	// Create a new cancelable context for ourselves, also used for Done and Err.
 	// This decouples cancellation from upstream context.
-	ctx2, cancel := context.WithCancel(context.Background())
+	ctx2, cancel := context.WithCancelCause(context.Background())
 	// Copy the deadline if one is set on the original context.
-	if deadline, ok := ctx.Deadline(); ok {
+	if deadline, ok := p.pctx.Deadline(); ok {
 		var dcancel context.CancelFunc
 		ctx2, dcancel = context.WithDeadline(ctx2, deadline)
 		p.dcancel = dcancel
 	}
 	p.ctx, p.cancel = ctx2, cancel
-	// Create a cancellable context for children.
-	chldCtx, chldCancel := context.WithCancel(ctx2)
-	p.chldCtx, p.chldCancel = chldCtx, chldCancel
+	// Cancellable contexts for children are created per tier as needed.
+	p.tiers = nil
+	p.drained = make(chan struct{})
+	p.closedCh = make(chan struct{})
+}
 
-	// When parent ctx ends we cancel all downstream Phasers and then our own context.
-	// This preserves ordering in that all children terminate before our context ends.
-	go func() {
-		<-p.pctx.Done()
-		p.doCancel()
-	}()
+// tierContext returns the context which cancels children of the given priority.
+func (p *Phaser) tierContext(priority int) context.Context {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.tierLocked(priority).ctx
+}
+
+// tierLocked returns the tier of children with the given priority, creating
+// it if necessary. Tiers are kept in order of priority. p.mu must be held.
+func (p *Phaser) tierLocked(priority int) *tier {
+	i := sort.Search(len(p.tiers), func(i int) bool {
+		return p.tiers[i].priority >= priority
+	})
+	if i < len(p.tiers) && p.tiers[i].priority == priority {
+		return p.tiers[i]
+	}
+	t := &tier{priority: priority, children: newChildCounter()}
+	t.ctx, t.cancel = context.WithCancelCause(p.ctx)
+	if p.canceling {
+		// Children created during cancellation are cancelled immediately.
+		t.cancel(p.cause)
+	}
+	p.tiers = append(p.tiers, nil)
+	copy(p.tiers[i+1:], p.tiers[i:])
+	p.tiers[i] = t
+	return t
+}
+
+// addChild registers a child with the Phaser, unless it has begun cancellation
+// or been prepared for shutdown.
+func (p *Phaser) addChild(child *Phaser) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.canceling {
+		return ErrParentClosing
+	}
+	if p.prepared {
+		return errPrepared
+	}
+	p.registerLocked(child)
+	return nil
+}
+
+// registerLocked registers a child with the Phaser. p.mu must be held.
+func (p *Phaser) registerLocked(child *Phaser) {
+	p.tierLocked(child.priority).children.Add()
+	if p.kids == nil {
+		p.kids = make(map[*Phaser]uint64)
+	}
+	p.kidSeq++
+	p.kids[child] = p.kidSeq
+}
+
+// removeChild notifies the Phaser that a child has closed. Children which
+// were never registered are ignored.
+func (p *Phaser) removeChild(child *Phaser) {
+	// Children are held in a map so that wide trees do not close in
+	// quadratic time.
+	p.mu.Lock()
+	_, ok := p.kids[child]
+	if !ok {
+		_, late := p.abandoned[child]
+		delete(p.abandoned, child)
+		p.mu.Unlock()
+		if late {
+			p.lateChild(child)
+		}
+		return
+	}
+	late := p.gaveUp
+	outOfOrder := false
+	if p.strictLIFO && !p.canceling {
+		seq := p.kids[child]
+		for _, s := range p.kids {
+			outOfOrder = outOfOrder || s > seq
+		}
+	}
+	delete(p.kids, child)
+	t := p.tierLocked(child.priority)
+	var sole *Phaser
+	if len(p.kids) == 1 {
+		for sole = range p.kids {
+		}
+	}
+	p.mu.Unlock()
+	// The drain may wake as soon as the count reaches zero, so the lock is
+	// released first to avoid it contending with other children closing.
+	t.children.Done()
+	p.checkLastStanding()
+	if sole != nil {
+		sole.checkLastStanding()
+	}
+	if late {
+		p.lateChild(child)
+	}
+	if outOfOrder {
+		Logger(p).Warn("phase: child closed before a younger sibling",
+			"parent", p.label(), "child", child.label())
+	}
+}
+
+// liveChildren returns the children of the Phaser which have not yet closed,
+// in the order they were created.
+func (p *Phaser) liveChildren() []*Phaser {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.liveChildrenLocked()
+}
+
+// liveChildrenLocked is like liveChildren. p.mu must be held.
+func (p *Phaser) liveChildrenLocked() []*Phaser {
+	kids := make([]*Phaser, 0, len(p.kids))
+	for child := range p.kids {
+		kids = append(kids, child)
+	}
+	sort.Slice(kids, func(i, j int) bool {
+		return p.kids[kids[i]] < p.kids[kids[j]]
+	})
+	return kids
 }
 
 // Next registers and returns a new child Phaser. This should be called to
 // create a new Phaser for each downstream component that needs ordered shutdown.
-func (p *Phaser) Next() *Phaser {
-	phaser := &Phaser{}
-	phaser.init(p.chldCtx)
-	p.children.Add(1)
-	phaser.tellParent = p.children.Done
+// If the Phaser has begun cancellation the child is not registered, so the
+// Phaser does not wait for it, and the child is cancelled immediately.
+func (p *Phaser) Next(opts ...Option) *Phaser {
+	return p.next(0, opts, nil)
+}
+
+// NextPriority is like Next but the child is cancelled in order of priority
+// among its siblings. When the Phaser is cancelled, children with the lowest
+// priority value are cancelled first, and each following priority is
+// cancelled only once all children of the previous one have closed.
+// Children created by Next have priority 0.
+func (p *Phaser) NextPriority(priority int, opts ...Option) *Phaser {
+	return p.next(priority, opts, nil)
+}
+
+// next creates a child Phaser with the given priority. If derive is not nil
+// it is applied to the context which cancels the child.
+func (p *Phaser) next(priority int, opts []Option, derive func(context.Context) context.Context) *Phaser {
+	phaser := p.newChild(priority, opts)
+	ctx := p.tierContext(priority)
+	if derive != nil {
+		ctx = derive(ctx)
+	}
+	phaser.init(ctx)
+	// Registration must not race with the wait for children which begins
+	// once canceling is set, so both happen under the lock.
+	if err := p.addChild(phaser); err == errPrepared {
+		// Without cancellation of the parent nothing else ends the child.
+		phaser.doCancel(ErrParentClosing, ReasonParentCanceled)
+	}
+	phaser.started()
+	return phaser
+}
+
+// newChild returns a child Phaser which is yet to be initialised.
+func (p *Phaser) newChild(priority int, opts []Option) *Phaser {
+	phaser := newPhaser(opts)
+	phaser.parent = p
+	phaser.depth = p.depth + 1
+	phaser.priority = priority
+	if phaser.vctx == nil {
+		// Values come from the parent, and so from the context it was
+		// created from, rather than from the context which cancels us.
+		phaser.vctx = p
+	}
 	return phaser
 }
 
+// NextN creates and registers n children as Next does, returning them all or
+// none. If the Phaser has begun cancellation no children are created and
+// ErrParentClosing is returned. All children are registered while holding
+// the Phaser's lock, so cancellation cannot begin part way through.
+func (p *Phaser) NextN(n int, opts ...Option) ([]*Phaser, error) {
+	phasers := make([]*Phaser, n)
+	p.mu.Lock()
+	if p.canceling || p.prepared {
+		p.mu.Unlock()
+		return nil, ErrParentClosing
+	}
+	t := p.tierLocked(0)
+	for i := range phasers {
+		phasers[i] = p.newChild(0, opts)
+		phasers[i].init(t.ctx)
+		p.registerLocked(phasers[i])
+	}
+	p.mu.Unlock()
+	for _, phaser := range phasers {
+		phaser.started()
+	}
+	return phasers, nil
+}
+
+// NextRetry is like NextN for a single child, but while the Phaser is not
+// accepting children it retries up to attempts times in all, sleeping for
+// backoff between attempts. This suits a Phaser which may be Reset shortly,
+// such as a subsystem being restarted by a supervisor, as Reset may run
+// concurrently with NextRetry. Once attempts are exhausted ErrParentClosing
+// is returned.
+func (p *Phaser) NextRetry(attempts int, backoff time.Duration, opts ...Option) (*Phaser, error) {
+	for i := 1; ; i++ {
+		phasers, err := p.NextN(1, opts...)
+		if err == nil {
+			return phasers[0], nil
+		}
+		if i >= attempts {
+			return nil, err
+		}
+		time.Sleep(backoff)
+	}
+}
+
+// NextTimeout is like Next but the child is also cancelled once d has elapsed,
+// after which its Err returns context.DeadlineExceeded. As with
+// context.WithTimeout, the deadline is never later than the Phaser's own.
+// The returned cancel function releases the timer and cancels the child as
+// if its parent had been cancelled. It should be called once the child is no
+// longer needed, and is distinct from the child's Cancel, which its owner
+// must still call.
+func (p *Phaser) NextTimeout(d time.Duration, opts ...Option) (*Phaser, context.CancelFunc) {
+	var cancel context.CancelFunc
+	phaser := p.next(0, opts, func(ctx context.Context) context.Context {
+		ctx, cancel = context.WithTimeout(ctx, d)
+		return ctx
+	})
+	return phaser, cancel
+}
+
+// NextAutoClose is like NextTimeout combined with AutoClose, for fire and
+// forget work with no owner goroutine to close it. The child is cancelled once
+// d has elapsed or its parent is cancelled, and closes itself once its own
+// children have terminated. The timer is released when it closes.
+func (p *Phaser) NextAutoClose(d time.Duration, opts ...Option) *Phaser {
+	phaser, cancel := p.NextTimeout(d, opts...)
+	spawn(func() {
+		<-phaser.Done()
+		cancel()
+		phaser.Cancel()
+	})
+	return phaser
+}
+
+// NextClamped is like NextTimeout but the timer is released once the child's
+// context is done, so there is no cancel function to call. As for
+// NextTimeout, the child's deadline is never later than the Phaser's own.
+func (p *Phaser) NextClamped(d time.Duration, opts ...Option) *Phaser {
+	phaser, cancel := p.NextTimeout(d, opts...)
+	spawn(func() {
+		<-phaser.Done()
+		cancel()
+	})
+	return phaser
+}
+
+// NextAny creates a child of the Phaser in the first of contexts which was
+// derived from one, as Next does, carrying the values of that context. The
+// child is also cancelled as soon as any of contexts is done, such as either
+// a shutdown signal or a request deadline, with that context's cause.
+// ErrNoPhaser is returned if none of contexts was derived from a Phaser.
+func NextAny(contexts ...context.Context) (*Phaser, error) {
+	var parent *Phaser
+	var values context.Context
+	for _, ctx := range contexts {
+		if parent = FindPhaser(ctx); parent != nil {
+			values = ctx
+			break
+		}
+	}
+	if parent == nil {
+		return nil, ErrNoPhaser
+	}
+	var cancel context.CancelCauseFunc
+	phaser := parent.next(0, []Option{withValues(values)}, func(ctx context.Context) context.Context {
+		ctx, cancel = context.WithCancelCause(ctx)
+		return ctx
+	})
+	stops := make([]func() bool, len(contexts))
+	for i, ctx := range contexts {
+		ctx := ctx
+		stops[i] = context.AfterFunc(ctx, func() { cancel(context.Cause(ctx)) })
+	}
+	spawn(func() {
+		<-phaser.Done()
+		for _, stop := range stops {
+			stop()
+		}
+		cancel(nil)
+	})
+	return phaser, nil
+}
+
+// NextWithShutdownDeadline is like Next but the child waits at most d for its
+// own children once its cancellation begins. After that its context ends
+// regardless, and any remaining children are abandoned, cancelled but not
+// waited for. This bounds the time a subsystem can hold up shutdown.
+func (p *Phaser) NextWithShutdownDeadline(d time.Duration, opts ...Option) *Phaser {
+	return p.next(0, append([]Option{withShutdownTimeout(d)}, opts...), nil)
+}
+
+// NextWithValues is like Next but the child also carries the values in kv,
+// as if each had been added with context.WithValue, for injecting several
+// dependencies at once.
+func (p *Phaser) NextWithValues(kv map[any]any, opts ...Option) *Phaser {
+	var ctx context.Context = p
+	for k, v := range kv {
+		ctx = context.WithValue(ctx, k, v)
+	}
+	return p.next(0, append([]Option{withValues(ctx)}, opts...), nil)
+}
+
+// NextWeighted is like Next but the child counts for weight, rather than 1,
+// in the progress reported by WaitForChildrenWeightedProgress.
+func (p *Phaser) NextWeighted(weight int, opts ...Option) *Phaser {
+	return p.next(0, append([]Option{withWeight(weight)}, opts...), nil)
+}
+
+// withWeight sets the weight reported by WaitForChildrenWeightedProgress.
+func withWeight(weight int) Option {
+	return func(p *Phaser) {
+		p.weight = weight
+	}
+}
+
+// NextWithTraceID is like Next but the child carries traceID, a correlation ID
+// reported by TraceID for the child and its descendants.
+func (p *Phaser) NextWithTraceID(traceID string, opts ...Option) *Phaser {
+	return p.next(0, append([]Option{withTraceID(traceID)}, opts...), nil)
+}
+
+// withTraceID sets the correlation ID reported by TraceID.
+func withTraceID(traceID string) Option {
+	return func(p *Phaser) {
+		p.traceID = traceID
+	}
+}
+
+// withShutdownTimeout sets how long a Phaser waits for its children once its
+// cancellation begins.
+func withShutdownTimeout(d time.Duration) Option {
+	return func(p *Phaser) {
+		p.shutdownTimeout = d
+	}
+}
+
+// AcceptingChildren reports whether the Phaser is still accepting children,
+// which it does until cancellation begins or PrepareShutdown is called. A
+// child created after that is cancelled immediately, so orchestration code can
+// check this before starting a new subsystem during shutdown.
+func (p *Phaser) AcceptingChildren() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.canceling && !p.prepared
+}
+
+// PrepareShutdown is the first step of a two step shutdown. It stops the
+// Phaser accepting children, as if cancellation had begun, but leaves its
+// context and existing children running. This lets an orchestrator check
+// that every subsystem has stopped taking new work before CommitShutdown.
+func (p *Phaser) PrepareShutdown() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.prepared = true
+}
+
+// StartDraining marks the Phaser as draining, reported by IsDraining. It is
+// for a component such as a queue which should finish its outstanding work
+// but take no more: producers check IsDraining before adding work, while the
+// owner empties the queue and then calls Cancel. The Phaser's context and
+// children are unaffected.
+func (p *Phaser) StartDraining() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.draining = true
+}
+
+// IsDraining reports whether StartDraining has been called.
+func (p *Phaser) IsDraining() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.draining
+}
+
+// StrictLIFO makes the Phaser check that its children close in the reverse
+// of the order they were created, as for a stack of resources which must be
+// unwound. A child which closes while a younger sibling is still open is
+// logged as a violation with the Phaser's Logger. Once the Phaser has begun
+// cancellation its children are cancelled together and may close in any
+// order, so they are no longer checked. It is a development aid for catching
+// unwinding bugs, and does not change the order of shutdown.
+func (p *Phaser) StrictLIFO() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.strictLIFO = true
+}
+
+// Suspend marks the Phaser as suspended, reported by Suspended, such as to
+// pause a subsystem for maintenance without closing it. Workers check
+// Suspended, or wait on SuspendChanged, and pause their own processing. The
+// Phaser's context and children are unaffected.
+func (p *Phaser) Suspend() {
+	p.setSuspended(true)
+}
+
+// Resume clears the suspension set by Suspend.
+func (p *Phaser) Resume() {
+	p.setSuspended(false)
+}
+
+func (p *Phaser) setSuspended(suspended bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.suspended == suspended {
+		return
+	}
+	p.suspended = suspended
+	if p.suspendCh != nil {
+		close(p.suspendCh)
+		p.suspendCh = nil
+	}
+}
+
+// Suspended reports whether the Phaser has been suspended and not resumed.
+func (p *Phaser) Suspended() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.suspended
+}
+
+// SuspendChanged returns a channel which is closed the next time the Phaser
+// is suspended or resumed. Call it again for a channel for the change after.
+func (p *Phaser) SuspendChanged() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.suspendCh == nil {
+		p.suspendCh = make(chan struct{})
+	}
+	return p.suspendCh
+}
+
+// CommitShutdown is the second step of a two step shutdown begun with
+// PrepareShutdown. It cancels the Phaser and waits for it, as CancelAndWait.
+func (p *Phaser) CommitShutdown() {
+	p.CancelAndWait()
+}
+
+// NextLimited is like Next but returns ErrMaxDepthExceeded, without creating
+// a child, if the child's depth would exceed maxDepth. It guards against
+// runaway recursion creating unbounded chains of Phasers.
+func (p *Phaser) NextLimited(maxDepth int, opts ...Option) (*Phaser, error) {
+	if p.depth+1 > maxDepth {
+		return nil, ErrMaxDepthExceeded
+	}
+	return p.Next(opts...), nil
+}
+
 // Cancel triggers cancellation of the Phaser chain. This must be called when Phaser context
 // has finished (context semantics, the Done() channel),, and may be called to trigger
 // cancellation of downstream phasers.
 func (p *Phaser) Cancel() {
+	p.CancelWithCause(nil)
+}
+
+// CancelWithCause is like Cancel but records cause as the reason for
+// cancellation, which is reported by context.Cause for the Phaser and its
+// descendants. A nil cause is reported as context.Canceled.
+// If cancellation has already begun the original cause is kept.
+func (p *Phaser) CancelWithCause(cause error) {
 	p.cancelOnce.Do(func() {
-		p.doCancel()
+		p.mu.Lock()
+		p.cancelled = true
+		p.mu.Unlock()
+		p.doCancel(cause, ReasonSelfCancel)
 		// Once our context is closed (after children terminate), notify parent.
-		if p.tellParent != nil {
-			go func() {
-				<-p.Done()
-				// Parent is notified when downstream phasers and this context have finished.
-				p.tellParent()
-			}()
+		spawn(func() {
+			<-p.Done()
+			p.closed()
+		})
+	})
+}
+
+// ForceClose cancels the Phaser like Cancel but stops waiting for its
+// children, so that one stuck child cannot hang shutdown. Children which have
+// not yet closed are abandoned: they are cancelled but no longer waited for,
+// and are logged as a warning with the Phaser's Logger. They are also
+// returned so the caller can act on them.
+func (p *Phaser) ForceClose() []*Phaser {
+	p.Cancel()
+	p.mu.Lock()
+	abandoned := p.liveChildrenLocked()
+	p.kids = nil
+	for _, child := range abandoned {
+		p.tierLocked(child.priority).children.Done()
+		if p.abandoned == nil {
+			p.abandoned = make(map[*Phaser]struct{})
 		}
+		p.abandoned[child] = struct{}{}
+	}
+	p.mu.Unlock()
+	for _, child := range abandoned {
+		child.mu.Lock()
+		child.orphaned = true
+		child.mu.Unlock()
+		Logger(p).Warn("phase: child abandoned by ForceClose",
+			"parent", p.label(), "child", child.label())
+	}
+	p.checkLastStanding()
+	return abandoned
+}
+
+// CancelAndWait cancels the Phaser and blocks until its context has finished,
+// which happens once all of its children have terminated. It may be called
+// more than once, including concurrently, and is suited to deferring in the
+// Phaser's owner. Cancellation begins exactly once and every caller waits for
+// the same drain of children.
+func (p *Phaser) CancelAndWait() {
+	p.Cancel()
+	<-p.Done()
+}
+
+// AutoClose arranges for Cancel to be called as soon as the Phaser's context is
+// done, for Phasers which have no cleanup of their own to perform. Without it
+// the owner of every Phaser must observe Done and call Cancel, otherwise the
+// parent waits forever.
+func (p *Phaser) AutoClose() {
+	spawn(func() {
+		<-p.Done()
+		p.Cancel()
 	})
 }
 
-func (p *Phaser) doCancel() {
-	// Immediately cancel child contexts to trigger downstream effects.
-	p.chldCancel()
+// Complete is used in place of Cancel by a Phaser that has finished its work
+// rather than being interrupted by shutdown. It has the same effect as Cancel,
+// but an Observer is notified with PhaseCompleted instead of PhaseClosed.
+// If cancellation has already begun the Phaser is treated as cancelled.
+func (p *Phaser) Complete() {
+	p.mu.Lock()
+	if !p.canceling {
+		p.completed = true
+	}
+	p.mu.Unlock()
+	p.Cancel()
+}
+
+// closed is called once the Phaser has been cancelled and its context has finished.
+func (p *Phaser) closed() {
+	if o := currentObserver(); o != nil {
+		p.mu.Lock()
+		d, completed := time.Since(p.canceledAt), p.completed
+		p.mu.Unlock()
+		if completed {
+			o.PhaseCompleted(p.Name(), d)
+		} else {
+			o.PhaseClosed(p.Name(), d)
+		}
+	}
+	// Parent is notified when downstream phasers and this context have finished.
+	if p.parent != nil {
+		p.parent.removeChild(p)
+	}
+	untrack(p)
+	p.emit(EventClosed)
+	close(p.closedCh)
+}
+
+// Reset reinitialises a closed Phaser so that it can be reused, for example
+// by a supervisor restarting a subsystem. The Phaser is registered again
+// with its parent and has a new context. Reset returns ErrNotClosed if Cancel
+// has not been called or the Phaser's context is not yet done, and
+// ErrParentClosing if the parent has begun cancellation.
+// Reset may be called concurrently with NextN and NextRetry, which use only
+// state guarded by the Phaser's lock, so that a caller retrying can create a
+// child as soon as the Phaser is reset. It must not be called concurrently
+// with any other method of the Phaser.
+func (p *Phaser) Reset() error {
+	p.mu.Lock()
+	closedCh := p.closedCh
+	closing := p.cancelled && p.ctx.Err() != nil
+	p.mu.Unlock()
+	if !closing {
+		return ErrNotClosed
+	}
+	// Allow the parent notification to complete.
+	<-closedCh
+
+	p.mu.Lock()
+	if p.pctx.Err() != nil {
+		p.mu.Unlock()
+		return ErrParentClosing
+	}
+	if p.parent != nil {
+		if err := p.parent.addChild(p); err != nil {
+			p.mu.Unlock()
+			return ErrParentClosing
+		}
+	}
+	p.initContexts()
+	p.cancelOnce = sync.Once{}
+	p.canceling, p.prepared, p.cancelled, p.completed = false, false, false, false
+	p.draining = false
+	p.gaveUp, p.abandoned, p.orphaned = false, nil, false
+	p.cancelText = ""
+	if p.suspended {
+		// Resuming is a change reported to SuspendChanged.
+		p.suspended = false
+		if p.suspendCh != nil {
+			close(p.suspendCh)
+			p.suspendCh = nil
+		}
+	}
+	p.canceledAt, p.waitStack, p.cause = time.Time{}, nil, nil
+	p.endReason = ReasonUnknown
+	p.ending = false
+	p.mu.Unlock()
+
+	// The goroutine watching the parent context is still running, since the
+	// parent context has not ended.
+	p.started()
+	return nil
+}
+
+// Restart replaces the subsystem run by p without disturbing its siblings, such
+// as to reload its configuration. It cancels p and waits for it to close, then
+// calls reinit with p's parent, or the context p was created from if it is a
+// root, to create its replacement. The result of reinit is returned.
+func Restart(p *Phaser, reinit func(parent context.Context) (*Phaser, error)) (*Phaser, error) {
+	p.CancelAndWait()
+	// Wait for p to be removed from its parent before adding its replacement.
+	p.mu.Lock()
+	closedCh := p.closedCh
+	p.mu.Unlock()
+	<-closedCh
+	var parent context.Context = p.pctx
+	if p.parent != nil {
+		parent = p.parent
+	}
+	return reinit(parent)
+}
+
+func (p *Phaser) doCancel(cause error, reason EndReason) {
+	p.mu.Lock()
+	if p.canceling {
+		// Cancellation has already begun.
+		p.mu.Unlock()
+		return
+	}
+	p.canceling = true
+	p.canceledAt = time.Now()
+	p.cause = cause
+	if reason == ReasonSelfCancel && p.ctx.Err() == context.DeadlineExceeded {
+		// Our copy of the deadline ended the context before Cancel was
+		// called, such as by AutoClose.
+		reason = ReasonDeadline
+	}
+	p.endReason = reason
+	if debugEnabled() {
+		p.waitStack = captureStack()
+	}
+	ctx, cancel, drained := p.ctx, p.cancel, p.drained
+	tiers := append([]*tier(nil), p.tiers...)
+	p.mu.Unlock()
+	if o := currentObserver(); o != nil {
+		o.PhaseCanceled(p.Name())
+	}
+	p.emit(EventCanceled)
+	// Immediately cancel the first tier of children to trigger downstream
+	// effects without waiting for the drain goroutine to be scheduled.
+	if len(tiers) > 0 {
+		tiers[0].cancel(cause)
+	}
 	// Wait in a goroutine for children to terminate, to avoid blocking.
-	go func() {
-		p.children.Wait()
+	spawn(func() {
+		if p.shutdownTimeout > 0 {
+			p.drainTimeout(tiers, cause, drained)
+		} else {
+			p.drain(tiers, cause, drained)
+		}
+		p.emit(EventChildrenDrained)
+		p.awaitHolds()
+		// If our deadline has passed let it end our context, which it is about
+		// to do, so that Err reports context.DeadlineExceeded.
+		if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+			<-ctx.Done()
+		}
 		// Once children have terminated we can cancel our own context.
-		p.cancel()
-	}()
+		cancel(cause)
+	})
+}
+
+// HoldOpen delays the end of the Phaser's context, even once it has been
+// cancelled, until a matching call to Release. It lets a subsystem finish a
+// critical section before honouring a shutdown. A hold may be taken after
+// cancellation has begun, but not once the context has ended, when
+// ErrPhaseClosed is returned. Holds do not delay a deadline.
+func (p *Phaser) HoldOpen() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ending || p.ctx.Err() != nil {
+		return ErrPhaseClosed
+	}
+	p.holds++
+	return nil
+}
+
+// Release releases a hold taken with HoldOpen.
+func (p *Phaser) Release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.holds == 0 {
+		panic("phase: Release without HoldOpen")
+	}
+	p.holds--
+	if p.holds == 0 {
+		p.holdCond.Broadcast()
+	}
+}
+
+// awaitHolds waits until there are no holds on the Phaser, then refuses any
+// more as its context is about to end.
+func (p *Phaser) awaitHolds() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.holds > 0 {
+		p.holdCond.Wait()
+	}
+	p.ending = true
+}
+
+// drain cancels children one tier at a time in order of priority, waiting for
+// each tier to terminate before the next, then closes drained.
+func (p *Phaser) drain(tiers []*tier, cause error, drained chan struct{}) {
+	for _, t := range tiers {
+		t.cancel(cause)
+		<-t.children.Wait()
+	}
+	p.runTreeDrained()
+	close(drained)
+}
+
+// drainTimeout is like drain but gives up waiting after the Phaser's shutdown
+// timeout, cancelling all remaining tiers at once.
+func (p *Phaser) drainTimeout(tiers []*tier, cause error, drained chan struct{}) {
+	timer := time.NewTimer(p.shutdownTimeout)
+	defer timer.Stop()
+	spawn(func() { p.drain(tiers, cause, drained) })
+	select {
+	case <-drained:
+	case <-timer.C:
+		p.mu.Lock()
+		p.gaveUp = true
+		p.mu.Unlock()
+		// Tiers already cancelled keep their cause.
+		for _, t := range tiers {
+			t.cancel(ErrShutdownTimeout)
+		}
+	}
+}
+
+// CanceledAt returns the time at which the Phaser's cancellation began, by
+// Cancel or by propagation from its parent, and whether it has begun. Later
+// calls to Cancel do not change it.
+func (p *Phaser) CanceledAt() (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.canceledAt, p.canceling
+}
+
+// ChildrenDone returns a channel which is closed once the Phaser has been
+// cancelled and all of its children have terminated. Children are only
+// waited for once cancellation has begun.
+func (p *Phaser) ChildrenDone() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.drained
+}
+
+// WaitForChildrenTimeout waits up to d for ChildrenDone, reporting whether all
+// children terminated in time. It does not cancel anything, and children
+// which terminate later are handled as usual.
+func (p *Phaser) WaitForChildrenTimeout(d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-p.ChildrenDone():
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+// WaitForChildrenProgress waits like ChildrenDone, calling fn every interval
+// with the number of children still outstanding, so that a long shutdown can
+// be seen to be making progress. It does not cancel anything.
+func (p *Phaser) WaitForChildrenProgress(interval time.Duration, fn func(remaining int)) {
+	p.waitProgress(interval, func() { fn(len(p.liveChildren())) })
+}
+
+// WaitForChildrenWeightedProgress is like WaitForChildrenProgress but reports
+// the total weight of the outstanding children, given by NextWeighted, so that
+// progress reflects the significance of each subsystem rather than a count.
+func (p *Phaser) WaitForChildrenWeightedProgress(interval time.Duration, fn func(remaining int)) {
+	p.waitProgress(interval, func() {
+		remaining := 0
+		for _, child := range p.liveChildren() {
+			remaining += child.weight
+		}
+		fn(remaining)
+	})
+}
+
+// waitProgress waits like ChildrenDone, calling report every interval.
+func (p *Phaser) waitProgress(interval time.Duration, report func()) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	done := p.ChildrenDone()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			report()
+		}
+	}
+}
+
+// Name returns the name given to the Phaser with WithName or SetName.
+func (p *Phaser) Name() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.name
+}
+
+// SetName renames the Phaser, for when its role only becomes clear after it
+// is created, such as a worker picking up a task. The new name is reported
+// by Name, Snapshot and to an Observer from then on.
+func (p *Phaser) SetName(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.name = name
+}
+
+// IsRoot reports whether the Phaser is a root, created by FromContext or New
+// rather than as the child of another Phaser.
+func (p *Phaser) IsRoot() bool {
+	return p.parent == nil
+}
+
+// Depth returns the number of Phasers above this one, with a Phaser created
+// by FromContext or New at depth 0.
+func (p *Phaser) Depth() int {
+	return p.depth
+}
+
+// Age returns the time since the Phaser was created. Reset does not change it.
+func (p *Phaser) Age() time.Duration {
+	return time.Since(p.createdAt)
+}
+
+// RegistrationReason returns the reason given with WithReason when the Phaser
+// was created, or an empty string if none was given.
+func (p *Phaser) RegistrationReason() string {
+	return p.reason
+}
+
+// Cond returns a condition variable associated with l which is broadcast when
+// the Phaser's context is done, waking any goroutines blocked in Wait.
+// Waiters should check Err() alongside their own condition after waking.
+func (p *Phaser) Cond(l sync.Locker) *sync.Cond {
+	c := sync.NewCond(l)
+	spawn(func() {
+		<-p.Done()
+		// Hold the lock so a waiter cannot miss the broadcast between
+		// checking Err() and calling Wait.
+		l.Lock()
+		c.Broadcast()
+		l.Unlock()
+	})
+	return c
+}
+
+// AfterDone arranges for fn to run in its own goroutine once the Phaser's
+// context is done, which is after its children have terminated, or at once if
+// it is already done. Calling the returned stop function prevents fn from
+// running, reporting whether it did so, as for context.AfterFunc.
+func (p *Phaser) AfterDone(fn func()) (stop func() bool) {
+	return context.AfterFunc(p.ctx, fn)
+}
+
+// OnTreeDrained registers fn to run once the Phaser has been cancelled and
+// all of its children have closed, before its own context ends. Called on a
+// root Phaser it runs cleanup, such as flushing a metrics buffer, only after
+// everything else has shut down. Functions run in the order they were
+// registered, in the goroutine which waits for the children. If a shutdown
+// deadline set by NextWithShutdownDeadline expires first, the Phaser's context
+// ends without waiting for the functions, which run only once the remaining
+// children do close. ForceClose stops counting the children it abandons, so
+// after it the functions run without waiting for those children.
+func (p *Phaser) OnTreeDrained(fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.treeDrained = append(p.treeDrained, fn)
+}
+
+// runTreeDrained runs and clears the functions registered with OnTreeDrained.
+func (p *Phaser) runTreeDrained() {
+	p.mu.Lock()
+	fns := p.treeDrained
+	p.treeDrained = nil
+	p.mu.Unlock()
+	for _, fn := range fns {
+		fn()
+	}
+}
+
+// AsContext returns the Phaser and CancelAndWait as a context and cancel
+// function pair, for code written in the style of
+// ctx, cancel := context.WithCancel(parent); defer cancel(). Unlike the cancel
+// function of the context package, the returned function blocks until the
+// Phaser's children have terminated and its context has finished.
+func (p *Phaser) AsContext() (context.Context, context.CancelFunc) {
+	return p, p.CancelAndWait
+}
+
+// Context returns the Phaser's own underlying context. It shares Done, Err
+// and Deadline with the Phaser, but does not carry values from the context
+// the Phaser was created from, as Value on the Phaser does. This suits code
+// which needs only the cancellation signal, or which inspects context types.
+func (p *Phaser) Context() context.Context {
+	return p.ctx
+}
+
+// WaitStack returns the stack captured when the Phaser began waiting for its
+// children to terminate, or nil if it has not begun waiting or debugging is
+// disabled (see SetDebug).
+// The stack is that of the goroutine which triggered the wait: the caller of
+// Cancel, or an internal goroutine if cancellation came from the parent
+// context. It is not possible to capture the stack of other goroutines.
+func (p *Phaser) WaitStack() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.waitStack
+}
+
+// CreationStack returns the stack captured when the Phaser was created, or nil
+// if debugging was disabled at the time (see SetDebug).
+func (p *Phaser) CreationStack() []byte {
+	return p.createStack
+}
+
+// phaserKey is the context key under which a Phaser returns itself, allowing
+// the nearest Phaser to be found from any context derived from it.
+type phaserKey struct{}
+
+// ancestor returns the nearest Phaser in ctx, or nil if there is none, as
+// described for FindPhaser. All lookups of a Phaser in a context use it, so
+// that they agree.
+func ancestor(ctx context.Context) *Phaser {
+	for ctx != nil {
+		if p, ok := ctx.(*Phaser); ok {
+			// Avoid the lookup for the common case of being given a Phaser.
+			return p
+		}
+		if p, ok := ctx.Value(phaserKey{}).(*Phaser); ok {
+			return p
+		}
+		u, ok := ctx.(interface{ Unwrap() context.Context })
+		if !ok {
+			return nil
+		}
+		ctx = u.Unwrap()
+	}
+	return nil
 }
 
 // Implement Context by wrapping calls to context objects.
-// Value point to the upstream context. Everything else to our new context.
+// Value points to the upstream context. Everything else to our new context.
 
 func (p *Phaser) Done() <-chan struct{} {
 	return p.ctx.Done()
@@ -102,10 +1192,64 @@ func (p *Phaser) Deadline() (deadline time.Time, ok bool) {
 	return p.ctx.Deadline()
 }
 
+// ShutdownDeadline returns the time at which a Phaser created by
+// NextWithShutdownDeadline stops waiting for its children, and true, once its
+// cancellation has begun. Otherwise it returns false. It is separate from
+// Deadline, which like that of any context does not change over time.
+func (p *Phaser) ShutdownDeadline() (time.Time, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.canceling || p.shutdownTimeout <= 0 {
+		return time.Time{}, false
+	}
+	return p.canceledAt.Add(p.shutdownTimeout), true
+}
+
+// DrainBudget returns the time remaining until the earliest deadline of the
+// Phaser and its ancestors, as reported by Deadline or ShutdownDeadline, and
+// whether any of them has one. A subsystem can use it during shutdown to
+// decide how much work it has time to flush. The budget is negative once the
+// deadline has passed.
+func (p *Phaser) DrainBudget() (time.Duration, bool) {
+	var earliest time.Time
+	found := false
+	for a := p; a != nil; a = a.parent {
+		for _, deadline := range a.deadlines() {
+			if !found || deadline.Before(earliest) {
+				earliest, found = deadline, true
+			}
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	return time.Until(earliest), true
+}
+
+// deadlines returns the Phaser's Deadline and ShutdownDeadline, where set.
+func (p *Phaser) deadlines() []time.Time {
+	var ds []time.Time
+	if d, ok := p.Deadline(); ok {
+		ds = append(ds, d)
+	}
+	if d, ok := p.ShutdownDeadline(); ok {
+		ds = append(ds, d)
+	}
+	return ds
+}
+
 func (p *Phaser) Err() error {
 	return p.ctx.Err()
 }
 
 func (p *Phaser) Value(key interface{}) interface{} {
-	return p.pctx.Value(key)
+	if key == (phaserKey{}) {
+		return p
+	}
+	// Our own context holds no values of its own, only those used internally
+	// by the context package such as for context.Cause. Let it answer those.
+	if v := p.ctx.Value(key); v != nil {
+		return v
+	}
+	return p.vctx.Value(key)
 }
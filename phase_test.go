@@ -2,6 +2,11 @@ package phase
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -42,10 +47,9 @@ func TestPhaseCancelHeirarchy(t *testing.T) {
 	}
 
 	// Cancel p01 phaser, which should also cancel p010 and p011 but nothing else.
+	// p01 is only done once its children are.
 	p01.Cancel()
-
-	// Allow time for goroutines to run.
-	time.Sleep(10 * time.Millisecond)
+	<-p01.Done()
 
 	for _, ctx := range []*Phaser{p0, p00} {
 		assertContextAlive(t, ctx)
@@ -56,7 +60,7 @@ func TestPhaseCancelHeirarchy(t *testing.T) {
 
 	// Cancel p0 and everything should end.
 	p0.Cancel()
-	time.Sleep(10 * time.Millisecond)
+	<-p0.Done()
 	for _, phaser := range []*Phaser{p0, p00, p01, p010, p011} {
 		assertContextFinished(t, phaser)
 	}
@@ -80,10 +84,8 @@ func TestPhaseChainedCancel(t *testing.T) {
 	// Cancel p0 context, which cancels the entire chain.
 	p0.Cancel()
 
-	// Allow time for goroutines to run.
-	time.Sleep(time.Millisecond)
-
-	assertContextFinished(t, p0)
+	// p0 is only done once the whole chain beneath it is.
+	<-p0.Done()
 	assertContextFinished(t, px)
 }
 
@@ -129,3 +131,1186 @@ func TestPhaseValue(t *testing.T) {
 		t.Errorf("Did not get expected value from context")
 	}
 }
+
+func TestPhaseCond(t *testing.T) {
+	p0 := FromContext(context.Background())
+	var mu sync.Mutex
+	cond := p0.Cond(&mu)
+
+	woken := make(chan struct{})
+	go func() {
+		mu.Lock()
+		for p0.Err() == nil {
+			cond.Wait()
+		}
+		mu.Unlock()
+		close(woken)
+	}()
+
+	p0.Cancel()
+	select {
+	case <-woken:
+	case <-time.After(time.Second):
+		t.Errorf("Expected cond waiter to be woken by cancellation")
+	}
+}
+
+func TestPhaseAfterDone(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	ran := make(chan struct{})
+	p0.AfterDone(func() {
+		// Children have terminated by the time fn runs.
+		assertContextFinished(t, p1)
+		close(ran)
+	})
+	stopped := p0.AfterDone(func() {
+		t.Errorf("Expected stopped function not to run")
+	})
+	if !stopped() {
+		t.Errorf("Expected stop to prevent the function running")
+	}
+
+	p0.Cancel()
+	p1.Cancel()
+	<-ran
+
+	// Registering once done runs fn at once.
+	late := make(chan struct{})
+	stop := p0.AfterDone(func() { close(late) })
+	<-late
+	if stop() {
+		t.Errorf("Expected stop to report the function had already run")
+	}
+}
+
+func TestPhaseRegistrationReason(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next(WithReason("handling connection from 10.0.0.1"))
+	if r := p1.RegistrationReason(); r != "handling connection from 10.0.0.1" {
+		t.Errorf("Did not get expected registration reason, got %q", r)
+	}
+	if r := p0.Next().RegistrationReason(); r != "" {
+		t.Errorf("Expected empty registration reason, got %q", r)
+	}
+}
+
+func TestPhaseDepth(t *testing.T) {
+	px := FromContext(context.Background())
+	for i := 0; i < 5; i++ {
+		if d := px.Depth(); d != i {
+			t.Errorf("Expected depth %d but got %d", i, d)
+		}
+		px = px.Next()
+	}
+}
+
+func TestPhaseAge(t *testing.T) {
+	p0 := FromContext(context.Background())
+	defer p0.Cancel()
+	if age := p0.Age(); age > 100*time.Millisecond {
+		t.Errorf("Expected a new Phaser to be near zero age but got %v", age)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if age := p0.Age(); age < 10*time.Millisecond {
+		t.Errorf("Expected age of at least 10ms but got %v", age)
+	}
+}
+
+func TestPhaseNextLimited(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1, err := p0.NextLimited(2)
+	if err != nil {
+		t.Fatalf("Unexpected error creating p1: %v", err)
+	}
+	p2, err := p1.NextLimited(2)
+	if err != nil {
+		t.Fatalf("Unexpected error creating p2 at max depth: %v", err)
+	}
+	if p2.Depth() != 2 {
+		t.Errorf("Expected depth 2 but got %d", p2.Depth())
+	}
+	p3, err := p2.NextLimited(2)
+	if err != ErrMaxDepthExceeded || p3 != nil {
+		t.Errorf("Expected ErrMaxDepthExceeded beyond max depth but got %v, %v", p3, err)
+	}
+}
+
+func TestPhaseAutoClose(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p0 := FromContext(ctx)
+	p1 := p0.Next()
+	p1.AutoClose()
+
+	// Cancelling the upstream context must close p1 without any goroutine of
+	// ours calling Cancel on it, allowing p0 to finish.
+	cancel()
+	select {
+	case <-p0.Done():
+	case <-time.After(time.Second):
+		t.Errorf("Expected p0 to finish after auto closing p1")
+	}
+	assertContextFinished(t, p1)
+}
+
+func TestPhaseReset(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+
+	if err := p1.Reset(); err != ErrNotClosed {
+		t.Errorf("Expected ErrNotClosed resetting a live phaser but got %v", err)
+	}
+
+	p1.Cancel()
+	<-p1.Done()
+	if err := p1.Reset(); err != nil {
+		t.Fatalf("Unexpected error resetting closed phaser: %v", err)
+	}
+	assertContextAlive(t, p1)
+
+	// The reset phaser is registered with p0 again, so p0 waits for it.
+	p0.Cancel()
+	<-p1.Done()
+	time.Sleep(10 * time.Millisecond)
+	assertContextAlive(t, p0)
+	p1.Cancel()
+	<-p0.Done()
+
+	if err := p1.Reset(); err != ErrParentClosing {
+		t.Errorf("Expected ErrParentClosing resetting under a closed parent but got %v", err)
+	}
+}
+
+// causeOf reads the cause as a third-party library would.
+func causeOf(ctx context.Context) error {
+	return context.Cause(ctx)
+}
+
+func TestRestart(t *testing.T) {
+	p0 := FromContext(context.Background())
+	web := p0.Next(WithName("web"))
+	pipeline := p0.Next(WithName("pipeline"))
+	pipeline.AutoClose()
+	db := p0.Next(WithName("db"))
+
+	restarted, err := Restart(pipeline, func(parent context.Context) (*Phaser, error) {
+		return parent.(*Phaser).Next(WithName("pipeline")), nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	assertContextFinished(t, pipeline)
+	assertContextAlive(t, restarted)
+	assertContextAlive(t, web)
+	assertContextAlive(t, db)
+	if n := len(p0.liveChildren()); n != 3 {
+		t.Errorf("Expected 3 children after restart but got %d", n)
+	}
+
+	errInit := errors.New("bad config")
+	if _, err := Restart(restarted, func(context.Context) (*Phaser, error) {
+		return nil, errInit
+	}); err != errInit {
+		t.Errorf("Expected %v but got %v", errInit, err)
+	}
+
+	web.Cancel()
+	db.Cancel()
+	p0.CancelAndWait()
+}
+
+func TestPhaseCause(t *testing.T) {
+	errShutdown := errors.New("operator requested shutdown")
+
+	// Cancelled directly with a cause.
+	p0 := FromContext(context.Background())
+	p0.CancelWithCause(errShutdown)
+	<-p0.Done()
+	if err := causeOf(p0); err != errShutdown {
+		t.Errorf("Expected cause %v but got %v", errShutdown, err)
+	}
+
+	// Cancelled by a parent Phaser with a cause.
+	p1 := FromContext(context.Background())
+	p10 := p1.Next()
+	p10.AutoClose()
+	p1.CancelWithCause(errShutdown)
+	<-p1.Done()
+	if err := causeOf(p10); err != errShutdown {
+		t.Errorf("Expected propagated cause %v but got %v", errShutdown, err)
+	}
+
+	// Cancelled without a cause.
+	p2 := FromContext(context.Background())
+	p2.Cancel()
+	<-p2.Done()
+	if err := causeOf(p2); err != context.Canceled {
+		t.Errorf("Expected cause %v but got %v", context.Canceled, err)
+	}
+
+	// Ended by a deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	p3 := FromContext(ctx)
+	<-p3.Done()
+	if err := causeOf(p3); err != context.DeadlineExceeded {
+		t.Errorf("Expected cause %v but got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestPhaseContext(t *testing.T) {
+	p0 := FromContext(WithValue(context.Background(), testKey{}, "value"))
+	ctx := p0.Context()
+	if ctx.Value(testKey{}) != nil {
+		t.Errorf("Expected underlying context not to carry upstream values")
+	}
+	if p0.Value(testKey{}) != "value" {
+		t.Errorf("Expected Phaser to carry upstream values")
+	}
+	if ctx.Done() != p0.Done() {
+		t.Errorf("Expected underlying context to share the Done channel")
+	}
+	p0.Cancel()
+	<-ctx.Done()
+	if ctx.Err() != p0.Err() {
+		t.Errorf("Expected underlying context to share Err")
+	}
+}
+
+func TestPhaseAsContext(t *testing.T) {
+	p0 := FromContext(context.Background())
+	ctx, cancel := p0.AsContext()
+	p1 := FindPhaser(ctx).Next()
+	closed := false
+	go func() {
+		<-p1.Done()
+		time.Sleep(10 * time.Millisecond)
+		closed = true
+		p1.Cancel()
+	}()
+
+	cancel()
+	if !closed {
+		t.Errorf("Expected cancel to wait for children")
+	}
+	assertContextFinished(t, ctx)
+	<-p0.closedCh
+}
+
+func TestPhaseAcceptingChildren(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	if !p0.AcceptingChildren() {
+		t.Errorf("Expected live phaser to accept children")
+	}
+	p0.Cancel()
+	if p0.AcceptingChildren() {
+		t.Errorf("Expected cancelled phaser not to accept children")
+	}
+	<-p1.Done()
+	if p1.AcceptingChildren() {
+		t.Errorf("Expected child of cancelled phaser not to accept children")
+	}
+	p1.Cancel()
+	<-p0.Done()
+}
+
+func TestPhaseNextParentWaiting(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p0.Cancel()
+	<-p1.Done()
+
+	// p0 is waiting for p1, so a new child is cancelled and not registered.
+	p2 := p0.Next()
+	select {
+	case <-p2.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Expected child of a waiting parent to be cancelled")
+	}
+	if n := len(p0.liveChildren()); n != 1 {
+		t.Errorf("Expected only p1 to be registered but got %d children", n)
+	}
+	p2.Cancel()
+	p1.Cancel()
+	<-p0.Done()
+}
+
+func TestPhasePrepareShutdown(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p1.AutoClose()
+
+	p0.PrepareShutdown()
+	if p0.AcceptingChildren() {
+		t.Errorf("Expected Phaser not to accept children once prepared")
+	}
+	p2 := p0.Next()
+	<-p2.Done()
+	if err := context.Cause(p2); err != ErrParentClosing {
+		t.Errorf("Expected %v but got %v", ErrParentClosing, err)
+	}
+	if _, err := p0.NextN(2); err != ErrParentClosing {
+		t.Errorf("Expected %v but got %v", ErrParentClosing, err)
+	}
+	assertContextAlive(t, p0)
+	assertContextAlive(t, p1)
+
+	p0.CommitShutdown()
+	assertContextFinished(t, p0)
+	assertContextFinished(t, p1)
+}
+
+func TestPhaseDraining(t *testing.T) {
+	p0 := FromContext(context.Background())
+	queue := p0.Next()
+	if queue.IsDraining() {
+		t.Errorf("Expected queue not to be draining")
+	}
+	queue.StartDraining()
+	if !queue.IsDraining() {
+		t.Errorf("Expected queue to be draining")
+	}
+	assertContextAlive(t, queue)
+	assertContextAlive(t, p0)
+
+	queue.Cancel()
+	p0.CancelAndWait()
+}
+
+func TestPhaseSuspend(t *testing.T) {
+	p0 := FromContext(context.Background())
+	defer p0.CancelAndWait()
+	assertChanged := func(ch <-chan struct{}, expected bool) {
+		t.Helper()
+		select {
+		case <-ch:
+			if !expected {
+				t.Errorf("Unexpected suspend change")
+			}
+		default:
+			if expected {
+				t.Errorf("Expected suspend change")
+			}
+		}
+	}
+
+	changed := p0.SuspendChanged()
+	if p0.Suspended() {
+		t.Errorf("Expected Phaser not to be suspended")
+	}
+	p0.Suspend()
+	if !p0.Suspended() {
+		t.Errorf("Expected Phaser to be suspended")
+	}
+	assertChanged(changed, true)
+	assertContextAlive(t, p0)
+
+	// Suspending again is not a change.
+	changed = p0.SuspendChanged()
+	p0.Suspend()
+	assertChanged(changed, false)
+
+	p0.Resume()
+	if p0.Suspended() {
+		t.Errorf("Expected Phaser to be resumed")
+	}
+	assertChanged(changed, true)
+}
+
+func TestPhaseSuspendReset(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p0.Suspend()
+	changed := p0.SuspendChanged()
+	p0.CancelAndWait()
+	if err := p0.Reset(); err != nil {
+		t.Fatalf("Unexpected error resetting: %v", err)
+	}
+	if p0.Suspended() {
+		t.Errorf("Expected Phaser not to be suspended after Reset")
+	}
+	select {
+	case <-changed:
+	default:
+		t.Errorf("Expected Reset to report the suspend change")
+	}
+	p0.CancelAndWait()
+}
+
+func TestPhaseCauseFromParentContext(t *testing.T) {
+	errDeploy := errors.New("deploying new version")
+	ctx, cancel := context.WithCancelCause(context.Background())
+	p0 := FromContext(ctx)
+	p1 := p0.Next()
+	p2 := p1.Next()
+	p1.AutoClose()
+	p2.AutoClose()
+
+	cancel(errDeploy)
+	<-p2.Done()
+	if err := context.Cause(p2); err != errDeploy {
+		t.Errorf("Expected grandchild cause %v but got %v", errDeploy, err)
+	}
+	if err := p2.Err(); err != context.Canceled {
+		t.Errorf("Expected grandchild Err %v but got %v", context.Canceled, err)
+	}
+	p0.Cancel()
+	<-p0.Done()
+	if err := context.Cause(p0); err != errDeploy {
+		t.Errorf("Expected root cause %v but got %v", errDeploy, err)
+	}
+}
+
+func TestPhaseConcurrentNextAndCancel(t *testing.T) {
+	// Children are created and closed concurrently with the parent beginning
+	// to wait for them. The parent must finish without a negative WaitGroup
+	// counter or waiting on a child it did not register.
+	for round := 0; round < 10; round++ {
+		p0 := FromContext(context.Background())
+		var wg sync.WaitGroup
+		for i := 0; i < 200; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				child := p0.Next()
+				child.AutoClose()
+				if i%2 == 0 {
+					child.Cancel()
+				}
+			}(i)
+			if i == 100 {
+				p0.Cancel()
+			}
+		}
+		wg.Wait()
+		select {
+		case <-p0.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("Expected parent to finish after concurrent children closed")
+		}
+	}
+}
+
+func TestPhaseNextRetry(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p1.CancelAndWait()
+	<-p1.closedCh
+	// p1 is restarted while NextRetry waits.
+	reset := make(chan error)
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		reset <- p1.Reset()
+	}()
+	p2, err := p1.NextRetry(100, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected child once p1 was reset but got %v", err)
+	}
+	if err := <-reset; err != nil {
+		t.Fatalf("Unexpected error resetting: %v", err)
+	}
+	p2.AutoClose()
+	p1.AutoClose()
+	p0.CancelAndWait()
+}
+
+func TestPhaseNextRetryExhausted(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p0.Cancel()
+	start := time.Now()
+	p1, err := p0.NextRetry(3, 5*time.Millisecond)
+	if err != ErrParentClosing || p1 != nil {
+		t.Errorf("Expected ErrParentClosing but got %v, %v", p1, err)
+	}
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Expected two backoffs but gave up after %v", elapsed)
+	}
+	<-p0.Done()
+}
+
+func TestPhaseNextTimeout(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1, cancel := p0.NextTimeout(10 * time.Millisecond)
+	defer cancel()
+	p1.AutoClose()
+	assertContextAlive(t, p1)
+
+	select {
+	case <-p1.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Expected child to finish after its timeout")
+	}
+	if err := p1.Err(); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+	assertContextAlive(t, p0)
+}
+
+func TestPhaseNextAutoClose(t *testing.T) {
+	p0 := FromContext(context.Background())
+	defer p0.Cancel()
+	before := len(p0.liveChildren())
+	p1 := p0.NextAutoClose(10 * time.Millisecond)
+	if n := len(p0.liveChildren()); n != before+1 {
+		t.Fatalf("Expected %d children but got %d", before+1, n)
+	}
+
+	select {
+	case <-p1.closedCh:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected child to close itself after its timeout")
+	}
+	if err := p1.Err(); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+	if n := len(p0.liveChildren()); n != before {
+		t.Errorf("Expected %d children but got %d", before, n)
+	}
+	assertContextAlive(t, p0)
+}
+
+func TestPhaseNextClamped(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		parent   time.Duration // zero for no parent deadline
+		d        time.Duration
+		expected time.Duration
+	}{
+		{"parent shorter", time.Minute, time.Hour, time.Minute},
+		{"parent longer", time.Hour, time.Minute, time.Minute},
+		{"no parent deadline", 0, time.Minute, time.Minute},
+	} {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if tc.parent > 0 {
+			ctx, cancel = context.WithTimeout(ctx, tc.parent)
+		}
+		p0 := FromContext(ctx)
+		p1 := p0.NextClamped(tc.d)
+		deadline, ok := p1.Deadline()
+		if !ok {
+			t.Errorf("%s: Expected child to have a deadline", tc.name)
+		} else if remaining := time.Until(deadline); remaining > tc.expected || remaining < tc.expected-time.Second {
+			t.Errorf("%s: Expected deadline in %v but got %v", tc.name, tc.expected, remaining)
+		}
+		p1.AutoClose()
+		p0.CancelAndWait()
+		cancel()
+	}
+}
+
+func TestPhaseNextPriority(t *testing.T) {
+	p0 := FromContext(context.Background())
+	results := make(chan string, 3)
+	for _, sibling := range []struct {
+		name     string
+		priority int
+	}{{"metrics", 3}, {"web", 1}, {"pipeline", 2}} {
+		p := p0.NextPriority(sibling.priority)
+		name := sibling.name
+		go func() {
+			<-p.Done()
+			// Give lower priority siblings a chance to run out of turn.
+			time.Sleep(5 * time.Millisecond)
+			results <- name
+			p.Cancel()
+		}()
+	}
+
+	p0.Cancel()
+	<-p0.Done()
+	for _, expected := range []string{"web", "pipeline", "metrics"} {
+		if v := <-results; v != expected {
+			t.Errorf("Expected %s to close next but got %s", expected, v)
+		}
+	}
+}
+
+func TestPhaseCancelAndWait(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p1.AutoClose()
+
+	p0.CancelAndWait()
+	if p0.Err() == nil {
+		t.Errorf("Expected Err to be set after CancelAndWait")
+	}
+	if n := len(p0.liveChildren()); n != 0 {
+		t.Errorf("Expected all children to have closed but %d remain", n)
+	}
+	assertContextFinished(t, p1)
+
+	// A second call returns immediately.
+	p0.CancelAndWait()
+}
+
+func TestPhaseConcurrentCancelAndWait(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	var wg sync.WaitGroup
+	returned := make(chan struct{}, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p0.CancelAndWait()
+			returned <- struct{}{}
+		}()
+	}
+	// No caller returns while the child is still running.
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-returned:
+		t.Fatalf("Expected CancelAndWait to block until the child closed")
+	default:
+	}
+	p1.Cancel()
+	wg.Wait()
+	assertContextFinished(t, p0)
+}
+
+func TestPhaseForceClose(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p1.AutoClose()
+	// p2 is stuck and never closes.
+	p2 := p1.Next(WithName("stuck"))
+	p0.Cancel()
+	if p1.WaitForChildrenTimeout(10 * time.Millisecond) {
+		t.Fatalf("Expected p1 to be waiting for its stuck child")
+	}
+
+	abandoned := p1.ForceClose()
+	if len(abandoned) != 1 || abandoned[0] != p2 {
+		t.Errorf("Expected the stuck child to be abandoned but got %v", abandoned)
+	}
+	select {
+	case <-p0.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Expected shutdown to proceed after ForceClose")
+	}
+	assertContextFinished(t, p2)
+
+	// The abandoned child closing late is ignored.
+	p2.Cancel()
+	<-p2.closedCh
+}
+
+func TestPhaseCanceledAt(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p1.AutoClose()
+	if _, ok := p0.CanceledAt(); ok {
+		t.Errorf("Expected no cancellation time before Cancel")
+	}
+
+	before := time.Now()
+	p0.Cancel()
+	at, ok := p0.CanceledAt()
+	if !ok || at.Before(before) {
+		t.Errorf("Expected cancellation time after %v but got %v, %v", before, at, ok)
+	}
+	<-p0.Done()
+	p0.Cancel()
+	if again, _ := p0.CanceledAt(); !again.Equal(at) {
+		t.Errorf("Expected repeated Cancel to keep %v but got %v", at, again)
+	}
+
+	// Propagated cancellation is recorded too.
+	if childAt, ok := p1.CanceledAt(); !ok || childAt.Before(at) {
+		t.Errorf("Expected propagated cancellation time after %v but got %v, %v", at, childAt, ok)
+	}
+}
+
+func TestPhaseWaitForChildrenTimeout(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p1.AutoClose()
+	p0.Cancel()
+	if !p0.WaitForChildrenTimeout(time.Second) {
+		t.Errorf("Expected children to terminate in time")
+	}
+	<-p0.Done()
+}
+
+func TestPhaseWaitForChildrenTimeoutExpired(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p0.Cancel()
+	if p0.WaitForChildrenTimeout(10 * time.Millisecond) {
+		t.Errorf("Expected wait for children to time out")
+	}
+	assertContextAlive(t, p0)
+
+	// A child terminating late is handled as usual.
+	p1.Cancel()
+	<-p0.ChildrenDone()
+	<-p0.Done()
+}
+
+func TestPhaseWaitForChildrenProgress(t *testing.T) {
+	p0 := FromContext(context.Background())
+	for i := 1; i <= 3; i++ {
+		p := p0.Next()
+		delay := time.Duration(i) * 30 * time.Millisecond
+		go func() {
+			<-p.Done()
+			time.Sleep(delay)
+			p.Cancel()
+		}()
+	}
+	p0.Cancel()
+
+	var counts []int
+	p0.WaitForChildrenProgress(10*time.Millisecond, func(remaining int) {
+		counts = append(counts, remaining)
+	})
+	if len(counts) == 0 || counts[0] != 3 {
+		t.Fatalf("Expected progress starting with 3 children but got %v", counts)
+	}
+	for i := 1; i < len(counts); i++ {
+		if counts[i] > counts[i-1] {
+			t.Errorf("Expected outstanding children to decrease but got %v", counts)
+		}
+	}
+	if last := counts[len(counts)-1]; last == 3 {
+		t.Errorf("Expected progress to be reported as children closed but got %v", counts)
+	}
+	<-p0.Done()
+}
+
+func TestPhaseWaitForChildrenWeightedProgress(t *testing.T) {
+	p0 := FromContext(context.Background())
+	for i, weight := range []int{5, 3, 1} {
+		p := p0.NextWeighted(weight)
+		delay := time.Duration(i+1) * 30 * time.Millisecond
+		go func() {
+			<-p.Done()
+			time.Sleep(delay)
+			p.Cancel()
+		}()
+	}
+	// Children created by Next have weight 1.
+	p0.Next().AutoClose()
+	p0.Cancel()
+
+	var weights []int
+	p0.WaitForChildrenWeightedProgress(10*time.Millisecond, func(remaining int) {
+		weights = append(weights, remaining)
+	})
+	// The unweighted child closes at once, then 5, 3 and 1 in turn.
+	seen := map[int]bool{}
+	for i, w := range weights {
+		seen[w] = true
+		if i > 0 && w > weights[i-1] {
+			t.Errorf("Expected remaining weight to decrease but got %v", weights)
+		}
+	}
+	for _, w := range []int{9, 4, 1} {
+		if !seen[w] {
+			t.Errorf("Expected remaining weight %d to be reported but got %v", w, weights)
+		}
+	}
+	<-p0.Done()
+}
+
+func TestPhaseNextWithShutdownDeadline(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.NextWithShutdownDeadline(20 * time.Millisecond)
+	p1.AutoClose()
+	// p2 is stuck and never closes.
+	p2 := p1.Next()
+	// p3 waits for p2 and so is not cancelled until p1 gives up.
+	p3 := p1.NextPriority(1)
+
+	start := time.Now()
+	p0.Cancel()
+	select {
+	case <-p0.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Expected p1 to give up on its stuck child")
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected p1 to wait for its shutdown deadline but finished after %v", elapsed)
+	}
+	assertContextFinished(t, p2)
+	<-p3.Done()
+	if err := context.Cause(p3); !IsShutdownTimeout(err) {
+		t.Errorf("Expected %v but got %v", ErrShutdownTimeout, err)
+	}
+	p2.Cancel()
+	p3.Cancel()
+}
+
+func TestPhaseShutdownDeadline(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		parent   time.Duration // zero for no parent deadline
+		expected time.Duration
+	}{
+		{"parent deadline later", time.Hour, time.Minute},
+		{"parent deadline sooner", time.Second, time.Second},
+		{"no parent deadline", 0, time.Minute},
+	} {
+		ctx, cancel := context.Background(), context.CancelFunc(func() {})
+		if tc.parent > 0 {
+			ctx, cancel = context.WithTimeout(ctx, tc.parent)
+		}
+		p0 := FromContext(ctx)
+		p1 := p0.NextWithShutdownDeadline(time.Minute)
+		p1.AutoClose()
+		// p2 keeps p1 waiting on its shutdown deadline.
+		p2 := p1.Next()
+
+		if _, ok := p1.ShutdownDeadline(); ok {
+			t.Errorf("%s: Expected no shutdown deadline before cancellation", tc.name)
+		}
+		before, hadDeadline := p1.Deadline()
+		p0.Cancel()
+		for p1.AcceptingChildren() {
+			time.Sleep(time.Millisecond)
+		}
+		deadline, ok := p1.ShutdownDeadline()
+		if !ok {
+			t.Errorf("%s: Expected a shutdown deadline once cancellation began", tc.name)
+		} else if remaining := time.Until(deadline); remaining > time.Minute || remaining < time.Minute-time.Second {
+			t.Errorf("%s: Expected shutdown deadline in %v but got %v", tc.name, time.Minute, remaining)
+		}
+		// Deadline does not change once cancellation begins.
+		if after, ok := p1.Deadline(); ok != hadDeadline || !after.Equal(before) {
+			t.Errorf("%s: Expected Deadline to be unchanged but got %v, %v", tc.name, after, ok)
+		}
+		// The drain budget is bounded by the sooner of the two.
+		if budget, ok := p2.DrainBudget(); !ok || budget > tc.expected || budget < tc.expected-time.Second {
+			t.Errorf("%s: Expected a drain budget of %v but got %v, %v", tc.name, tc.expected, budget, ok)
+		}
+		p2.Cancel()
+		<-p0.Done()
+		cancel()
+	}
+}
+
+func TestPhaseIsRoot(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	if !p0.IsRoot() {
+		t.Errorf("Expected p0 to be a root")
+	}
+	if p1.IsRoot() {
+		t.Errorf("Expected p1 not to be a root")
+	}
+	// A Phaser created from a context holding another Phaser is still a root.
+	if !FromContext(p1).IsRoot() {
+		t.Errorf("Expected phaser created by FromContext to be a root")
+	}
+}
+
+func TestPhaseNextN(t *testing.T) {
+	p0 := FromContext(context.Background())
+	workers, err := p0.NextN(5, WithName("worker"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(workers) != 5 || len(p0.liveChildren()) != 5 {
+		t.Fatalf("Expected 5 registered workers but got %d", len(p0.liveChildren()))
+	}
+	for _, w := range workers {
+		if w.Name() != "worker" || w.Depth() != 1 {
+			t.Errorf("Unexpected worker %q at depth %d", w.Name(), w.Depth())
+		}
+		w.AutoClose()
+	}
+	p0.CancelAndWait()
+}
+
+func TestPhaseNextNParentClosing(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p0.Cancel()
+	workers, err := p0.NextN(5)
+	if err != ErrParentClosing || workers != nil {
+		t.Errorf("Expected ErrParentClosing but got %v, %v", workers, err)
+	}
+	// Nothing was registered beyond the existing child.
+	if n := len(p0.liveChildren()); n != 1 {
+		t.Errorf("Expected only the existing child to be registered but got %d", n)
+	}
+	p1.Cancel()
+	<-p0.Done()
+}
+
+func TestPhaseErrAfterClose(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p0.CancelAndWait()
+	<-p0.closedCh
+	if err := p0.Err(); err != context.Canceled {
+		t.Errorf("Expected %v but got %v", context.Canceled, err)
+	}
+}
+
+func TestPhaseHoldOpen(t *testing.T) {
+	p0 := FromContext(context.Background())
+	if err := p0.HoldOpen(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	p0.Cancel()
+	time.Sleep(10 * time.Millisecond)
+	assertContextAlive(t, p0)
+
+	p0.Release()
+	<-p0.Done()
+	if err := p0.HoldOpen(); err != ErrPhaseClosed {
+		t.Errorf("Expected %v after Done but got %v", ErrPhaseClosed, err)
+	}
+}
+
+func TestPhaseHoldOpenAfterCancel(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p0.Cancel()
+	// The parent is waiting for its child, so a hold can still be taken.
+	if err := p0.HoldOpen(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	p1.Cancel()
+	<-p0.ChildrenDone()
+	time.Sleep(10 * time.Millisecond)
+	assertContextAlive(t, p0)
+
+	p0.Release()
+	<-p0.Done()
+}
+
+func BenchmarkWideClose(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		p0 := FromContext(context.Background())
+		children := make([]*Phaser, 10000)
+		for j := range children {
+			children[j] = p0.Next()
+		}
+		p0.Cancel()
+		// Close the newest children first, the worst case for finding them.
+		for j := len(children) - 1; j >= 0; j-- {
+			children[j].Cancel()
+		}
+		<-p0.Done()
+	}
+}
+
+func BenchmarkNext(b *testing.B) {
+	p0 := FromContext(context.Background())
+	defer p0.Cancel()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p1 := p0.Next()
+		p1.Cancel()
+		<-p1.closedCh
+	}
+}
+
+func TestNextAny(t *testing.T) {
+	errSignal := errors.New("signal")
+	for _, tc := range []struct {
+		name    string
+		timeout time.Duration // of the request context
+		trigger func(p0 *Phaser, signal context.CancelCauseFunc)
+		cause   error
+	}{
+		{"signal", time.Minute, func(p0 *Phaser, signal context.CancelCauseFunc) { signal(errSignal) }, errSignal},
+		{"deadline", 20 * time.Millisecond, func(p0 *Phaser, signal context.CancelCauseFunc) {}, context.DeadlineExceeded},
+		{"parent", time.Minute, func(p0 *Phaser, signal context.CancelCauseFunc) { p0.Cancel() }, context.Canceled},
+	} {
+		p0 := FromContext(context.Background())
+		signal, cancelSignal := context.WithCancelCause(context.Background())
+		request, cancelRequest := context.WithTimeout(context.Background(), tc.timeout)
+
+		p1, err := NextAny(signal, request, p0)
+		if err != nil {
+			t.Fatalf("%s: Unexpected error: %v", tc.name, err)
+		}
+		if n := len(p0.liveChildren()); n != 1 {
+			t.Errorf("%s: Expected child to be registered with p0 but it has %d children", tc.name, n)
+		}
+		p1.AutoClose()
+		assertContextAlive(t, p1)
+
+		tc.trigger(p0, cancelSignal)
+		select {
+		case <-p1.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("%s: Expected child to finish", tc.name)
+		}
+		if cause := context.Cause(p1); cause != tc.cause {
+			t.Errorf("%s: Expected cause %v but got %v", tc.name, tc.cause, cause)
+		}
+		p0.CancelAndWait()
+		cancelSignal(nil)
+		cancelRequest()
+	}
+}
+
+func TestNextAnyValues(t *testing.T) {
+	p0 := FromContext(context.Background())
+	signal, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p1, err := NextAny(signal, context.WithValue(p0, testKey{}, "value"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if v := p1.Value(testKey{}); v != "value" {
+		t.Errorf("Expected child to carry values from its context but got %v", v)
+	}
+	p1.AutoClose()
+	p0.CancelAndWait()
+}
+
+func TestNextAnyNoPhaser(t *testing.T) {
+	if p, err := NextAny(context.Background()); err != ErrNoPhaser || p != nil {
+		t.Errorf("Expected ErrNoPhaser but got %v, %v", p, err)
+	}
+}
+
+func TestPhaseDrainBudget(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	p0 := FromContext(ctx)
+	p1 := p0.Next()
+	p2 := p1.Next()
+	budget, ok := p2.DrainBudget()
+	if !ok {
+		t.Errorf("Expected a drain budget from the root deadline")
+	} else if budget > time.Minute || budget < time.Minute-time.Second {
+		t.Errorf("Expected a budget of about a minute but got %v", budget)
+	}
+	p2.AutoClose()
+	p1.AutoClose()
+	p0.CancelAndWait()
+}
+
+func TestPhaseDrainBudgetShutdownDeadline(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.NextWithShutdownDeadline(time.Minute)
+	p2 := p1.Next()
+	if _, ok := p2.DrainBudget(); ok {
+		t.Errorf("Expected no drain budget before shutdown")
+	}
+
+	p0.Cancel()
+	<-p2.Done()
+	for p1.AcceptingChildren() {
+		time.Sleep(time.Millisecond)
+	}
+	// p1 now limits how long it waits for its children.
+	if budget, ok := p2.DrainBudget(); !ok || budget > time.Minute {
+		t.Errorf("Expected a budget of at most a minute but got %v, %v", budget, ok)
+	}
+	p2.Cancel()
+	p1.AutoClose()
+	<-p0.Done()
+}
+
+func TestPhaseDrainBudgetNoDeadline(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	if budget, ok := p1.DrainBudget(); ok {
+		t.Errorf("Expected no drain budget but got %v", budget)
+	}
+	p1.AutoClose()
+	p0.CancelAndWait()
+}
+
+func TestPhaseOnTreeDrainedShutdownDeadline(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.NextWithShutdownDeadline(10 * time.Millisecond)
+	p1.AutoClose()
+	p2 := p1.Next()
+	ran := make(chan struct{})
+	p1.OnTreeDrained(func() { close(ran) })
+
+	// p1 gives up waiting for p2, but its finalizer waits for p2 to close.
+	p0.Cancel()
+	<-p1.Done()
+	select {
+	case <-ran:
+		t.Errorf("Expected finalizer not to run while p2 is open")
+	case <-time.After(10 * time.Millisecond):
+	}
+	p2.Cancel()
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected finalizer to run once p2 closed")
+	}
+	<-p0.Done()
+}
+
+func TestPhaseOnTreeDrained(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p2 := p1.Next()
+	for _, p := range []*Phaser{p1, p2} {
+		p := p
+		go func() {
+			<-p.Done()
+			time.Sleep(5 * time.Millisecond)
+			p.Cancel()
+		}()
+	}
+
+	var order []int
+	for i := 0; i < 3; i++ {
+		i := i
+		p0.OnTreeDrained(func() {
+			if len(p0.liveChildren()) != 0 || len(p1.liveChildren()) != 0 {
+				t.Errorf("Expected finalizer to run after all descendants have closed")
+			}
+			assertContextAlive(t, p0)
+			order = append(order, i)
+		})
+	}
+	p0.CancelAndWait()
+	if !reflect.DeepEqual(order, []int{0, 1, 2}) {
+		t.Errorf("Expected finalizers to run in registration order but got %v", order)
+	}
+}
+
+func TestPhaseStrictLIFO(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		order     []int // indices of children in the order they close
+		violation bool
+	}{
+		{"lifo", []int{2, 1, 0}, false},
+		{"out of order", []int{1, 2, 0}, true},
+	} {
+		var buf syncBuffer
+		p0 := FromContext(context.Background())
+		stack := p0.NextWithLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+		stack.StrictLIFO()
+		resources := []*Phaser{stack.Next(), stack.Next(), stack.Next()}
+		for _, i := range tc.order {
+			resources[i].Cancel()
+			<-resources[i].closedCh
+		}
+		if got := strings.Contains(buf.String(), "closed before a younger sibling"); got != tc.violation {
+			t.Errorf("%s: Expected violation %v but got log %q", tc.name, tc.violation, buf.String())
+		}
+		stack.AutoClose()
+		p0.CancelAndWait()
+	}
+}
+
+func TestPhaseStrictLIFOParentCanceled(t *testing.T) {
+	var buf syncBuffer
+	p0 := FromContext(context.Background())
+	stack := p0.NextWithLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+	stack.StrictLIFO()
+	stack.AutoClose()
+	for i := 0; i < 20; i++ {
+		stack.Next().AutoClose()
+	}
+	// Children cancelled together by their parent may close in any order.
+	p0.CancelAndWait()
+	if s := buf.String(); s != "" {
+		t.Errorf("Expected no violations during shutdown but got %q", s)
+	}
+}
@@ -0,0 +1,80 @@
+package phase
+
+import "context"
+
+// EndReason describes why a Phaser's cancellation began.
+type EndReason int
+
+const (
+	// ReasonUnknown is reported by a Phaser whose cancellation has not begun.
+	ReasonUnknown EndReason = iota
+	// ReasonSelfCancel is reported when the Phaser was cancelled by a call
+	// to Cancel or one of its variants.
+	ReasonSelfCancel
+	// ReasonParentCanceled is reported when cancellation propagated from the
+	// parent Phaser or context.
+	ReasonParentCanceled
+	// ReasonDeadline is reported when the deadline of the parent context
+	// passed.
+	ReasonDeadline
+)
+
+func (r EndReason) String() string {
+	switch r {
+	case ReasonSelfCancel:
+		return "self cancel"
+	case ReasonParentCanceled:
+		return "parent canceled"
+	case ReasonDeadline:
+		return "deadline"
+	default:
+		return "unknown"
+	}
+}
+
+// EndReason reports why the Phaser's cancellation began, or ReasonUnknown if
+// it has not.
+func (p *Phaser) EndReason() EndReason {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.endReason == ReasonUnknown && p.ctx.Err() == context.DeadlineExceeded {
+		// Our own copy of the deadline can end the context before
+		// cancellation is seen to begin.
+		return ReasonDeadline
+	}
+	return p.endReason
+}
+
+// SelfCanceled reports whether the Phaser's cancellation began with a call to
+// Cancel, or one of its variants, on the Phaser itself, rather than being
+// inherited from its parent or a deadline.
+func (p *Phaser) SelfCanceled() bool {
+	return p.EndReason() == ReasonSelfCancel
+}
+
+// CancelReason is like Cancel but records a human readable reason for the
+// shutdown, such as "deploying v2", reported by Reason on the Phaser and its
+// descendants. Only the first reason given to a Phaser is kept.
+func (p *Phaser) CancelReason(reason string) {
+	p.mu.Lock()
+	if p.cancelText == "" {
+		p.cancelText = reason
+	}
+	p.mu.Unlock()
+	p.Cancel()
+}
+
+// Reason returns the reason given to CancelReason on the Phaser or, failing
+// that, on its nearest ancestor which was given one, for logging why a
+// subsystem is shutting down. It returns "" if there is none.
+func (p *Phaser) Reason() string {
+	for a := p; a != nil; a = a.parent {
+		a.mu.Lock()
+		reason := a.cancelText
+		a.mu.Unlock()
+		if reason != "" {
+			return reason
+		}
+	}
+	return ""
+}
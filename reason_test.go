@@ -0,0 +1,139 @@
+package phase
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestEndReasonSelfCancel(t *testing.T) {
+	p0 := FromContext(context.Background())
+	if r := p0.EndReason(); r != ReasonUnknown {
+		t.Errorf("Expected %v before cancellation but got %v", ReasonUnknown, r)
+	}
+	p0.CancelAndWait()
+	if r := p0.EndReason(); r != ReasonSelfCancel {
+		t.Errorf("Expected %v but got %v", ReasonSelfCancel, r)
+	}
+}
+
+func TestEndReasonParentCanceled(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p0.Cancel()
+	<-p1.Done()
+	if r := p1.EndReason(); r != ReasonParentCanceled {
+		t.Errorf("Expected %v but got %v", ReasonParentCanceled, r)
+	}
+	// Cancelling after propagation does not change the reason.
+	p1.Cancel()
+	if r := p1.EndReason(); r != ReasonParentCanceled {
+		t.Errorf("Expected %v but got %v", ReasonParentCanceled, r)
+	}
+	<-p0.Done()
+}
+
+func TestEndReasonDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	p0 := FromContext(ctx)
+	<-p0.Done()
+	if r := p0.EndReason(); r != ReasonDeadline {
+		t.Errorf("Expected %v but got %v", ReasonDeadline, r)
+	}
+	p0.Cancel()
+}
+
+func TestEndReasonDeadlineDescendants(t *testing.T) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(10*time.Millisecond))
+	defer cancel()
+	p0 := FromContext(ctx)
+	p1 := p0.Next()
+	p2, cancel2 := p0.NextTimeout(time.Minute)
+	defer cancel2()
+	p3 := FromContext(context.Background())
+	p4, cancel4 := p3.NextTimeout(10 * time.Millisecond)
+	defer cancel4()
+	for _, p := range []*Phaser{p1, p2, p4} {
+		p.AutoClose()
+	}
+	for i, p := range []*Phaser{p0, p1, p2, p4} {
+		<-p.Done()
+		if r := p.EndReason(); r != ReasonDeadline {
+			t.Errorf("Phaser %d: Expected %v but got %v", i, ReasonDeadline, r)
+		}
+	}
+	p0.Cancel()
+	p3.CancelAndWait()
+	if r := p3.EndReason(); r != ReasonSelfCancel {
+		t.Errorf("Expected %v but got %v", ReasonSelfCancel, r)
+	}
+}
+
+func TestSelfCanceled(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p1.AutoClose()
+	if p0.SelfCanceled() {
+		t.Errorf("Expected SelfCanceled to be false before cancellation")
+	}
+	p0.CancelAndWait()
+	if !p0.SelfCanceled() {
+		t.Errorf("Expected SelfCanceled after Cancel")
+	}
+	if p1.SelfCanceled() {
+		t.Errorf("Expected SelfCanceled to be false after propagation from the parent")
+	}
+}
+
+func TestCancelReason(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p2 := p1.Next()
+	p2.AutoClose()
+	p1.AutoClose()
+	if r := p2.Reason(); r != "" {
+		t.Errorf("Expected no reason before cancellation but got %q", r)
+	}
+
+	p0.CancelReason("deploying v2")
+	<-p0.Done()
+	// A later reason is ignored.
+	p0.CancelReason("OOM protection")
+	for _, p := range []*Phaser{p0, p1, p2} {
+		if r := p.Reason(); r != "deploying v2" {
+			t.Errorf("Expected reason %q but got %q", "deploying v2", r)
+		}
+	}
+}
+
+func TestCancelReasonNearest(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	p2 := p1.Next()
+	p2.AutoClose()
+	p1.CancelReason("rebalancing")
+	<-p1.Done()
+	p0.CancelReason("deploying v2")
+	<-p0.Done()
+	if r := p2.Reason(); r != "rebalancing" {
+		t.Errorf("Expected the nearest ancestor's reason but got %q", r)
+	}
+}
+
+func TestCancelReasonReset(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p0.CancelReason("old")
+	<-p0.Done()
+	if err := p0.Reset(); err != nil {
+		t.Fatalf("Unexpected error resetting: %v", err)
+	}
+	if r := p0.Reason(); r != "" {
+		t.Errorf("Expected no reason after Reset but got %q", r)
+	}
+	p0.CancelReason("new")
+	<-p0.Done()
+	if r := p0.Reason(); r != "new" {
+		t.Errorf("Expected reason %q after Reset but got %q", "new", r)
+	}
+}
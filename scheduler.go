@@ -0,0 +1,45 @@
+package phase
+
+import "sync"
+
+// Scheduler starts the goroutines which the package runs internally, such as
+// those propagating cancellation down the tree. It is a hook for wrapping each
+// of those goroutines, for example to recover and report a panic in a test.
+// The Scheduler is shared by every Phaser in the program, including those of
+// other tests, so it cannot tell which tree a goroutine belongs to and is not
+// a way to wait for the work of one tree to finish; wait on Done instead.
+// Programs should use the default, which simply starts a goroutine.
+type Scheduler interface {
+	// Go runs fn in a new goroutine.
+	Go(fn func())
+}
+
+type goScheduler struct{}
+
+func (goScheduler) Go(fn func()) {
+	go fn()
+}
+
+var (
+	schedulerMu sync.RWMutex
+	scheduler   Scheduler = goScheduler{}
+)
+
+// SetScheduler sets the Scheduler used to start internal goroutines of all
+// Phasers. Passing nil restores the default.
+func SetScheduler(s Scheduler) {
+	if s == nil {
+		s = goScheduler{}
+	}
+	schedulerMu.Lock()
+	defer schedulerMu.Unlock()
+	scheduler = s
+}
+
+// spawn runs fn in a new goroutine started by the current Scheduler.
+func spawn(fn func()) {
+	schedulerMu.RLock()
+	s := scheduler
+	schedulerMu.RUnlock()
+	s.Go(fn)
+}
@@ -0,0 +1,38 @@
+package phase
+
+import "context"
+
+// Semaphore bounds the number of goroutines concurrently working within a
+// Phaser. Each acquired slot holds the Phaser open as HoldOpen does, so its
+// context does not end while work is in flight.
+type Semaphore struct {
+	p     *Phaser
+	slots chan struct{}
+}
+
+// NewSemaphore returns a Semaphore of n slots for work within p.
+func NewSemaphore(p *Phaser, n int) *Semaphore {
+	return &Semaphore{p: p, slots: make(chan struct{}, n)}
+}
+
+// Acquire blocks until a slot is free and takes it, or returns ctx.Err() if
+// ctx is done first. It returns ErrPhaseClosed if the Phaser's context has
+// ended. Each successful Acquire must be matched by a call to Release.
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := s.p.HoldOpen(); err != nil {
+		<-s.slots
+		return err
+	}
+	return nil
+}
+
+// Release frees a slot taken by Acquire.
+func (s *Semaphore) Release() {
+	s.p.Release()
+	<-s.slots
+}
@@ -0,0 +1,76 @@
+package phase
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSemaphore(t *testing.T) {
+	p0 := FromContext(context.Background())
+	s := NewSemaphore(p0, 3)
+
+	var mu sync.Mutex
+	live, maxLive := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Acquire(p0); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+			mu.Lock()
+			live++
+			if live > maxLive {
+				maxLive = live
+			}
+			mu.Unlock()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			live--
+			mu.Unlock()
+			s.Release()
+		}()
+	}
+	wg.Wait()
+	if maxLive != 3 {
+		t.Errorf("Expected at most 3 concurrent holders but got %d", maxLive)
+	}
+	p0.CancelAndWait()
+}
+
+func TestSemaphoreBlocksShutdown(t *testing.T) {
+	p0 := FromContext(context.Background())
+	s := NewSemaphore(p0, 1)
+	if err := s.Acquire(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	p0.Cancel()
+	time.Sleep(10 * time.Millisecond)
+	assertContextAlive(t, p0)
+
+	s.Release()
+	<-p0.Done()
+	if err := s.Acquire(context.Background()); err != ErrPhaseClosed {
+		t.Errorf("Expected ErrPhaseClosed but got %v", err)
+	}
+}
+
+func TestSemaphoreAcquireCanceled(t *testing.T) {
+	p0 := FromContext(context.Background())
+	defer p0.CancelAndWait()
+	s := NewSemaphore(p0, 1)
+	if err := s.Acquire(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer s.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded but got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package phase
+
+import (
+	"context"
+	"fmt"
+)
+
+// Sequence runs named stages strictly one after another, such as the "drain",
+// "flush" and "persist" stages of a shutdown. Each stage runs in its own
+// Phaser, which is closed, along with any children the stage created, before
+// the next stage begins.
+type Sequence struct {
+	parent context.Context
+	stages []stage
+}
+
+type stage struct {
+	name string
+	fn   func(ctx context.Context) error
+}
+
+// NewSequence returns an empty Sequence whose stages run under parent.
+func NewSequence(parent context.Context) *Sequence {
+	return &Sequence{parent: parent}
+}
+
+// AddStage appends a stage to the Sequence. fn is passed the stage's Phaser,
+// named name, and the stage ends when fn returns.
+func (s *Sequence) AddStage(name string, fn func(ctx context.Context) error) {
+	s.stages = append(s.stages, stage{name: name, fn: fn})
+}
+
+// Run runs the stages in the order they were added, waiting for each stage's
+// Phaser to close before starting the next. If parent was derived from a
+// Phaser each stage's Phaser is its child, so that it waits for the running
+// stage during shutdown. Run stops at the first stage to return an error,
+// which is returned annotated with the stage name.
+func (s *Sequence) Run() error {
+	parent := FindPhaser(s.parent)
+	for _, st := range s.stages {
+		var p *Phaser
+		if parent != nil {
+			p = parent.Next(withValues(s.parent), WithName(st.name))
+		} else {
+			p = FromContext(s.parent, WithName(st.name))
+		}
+		err := st.fn(p)
+		p.CancelAndWait()
+		if err != nil {
+			return fmt.Errorf("phase: stage %s: %w", st.name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package phase
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSequence(t *testing.T) {
+	var order []string
+	seq := NewSequence(context.Background())
+	for _, name := range []string{"drain", "flush", "persist"} {
+		name := name
+		seq.AddStage(name, func(ctx context.Context) error {
+			// Work started by the stage finishes before the next stage.
+			p := ctx.(*Phaser).Next()
+			go func() {
+				<-p.Done()
+				time.Sleep(5 * time.Millisecond)
+				order = append(order, name+" worker")
+				p.Cancel()
+			}()
+			order = append(order, name)
+			return nil
+		})
+	}
+	if err := seq.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{"drain", "drain worker", "flush", "flush worker", "persist", "persist worker"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected stages to run in order %v but got %v", expected, order)
+	}
+}
+
+func TestSequenceAbort(t *testing.T) {
+	errFlush := errors.New("flush failed")
+	var order []string
+	seq := NewSequence(context.Background())
+	seq.AddStage("drain", func(ctx context.Context) error {
+		order = append(order, "drain")
+		return nil
+	})
+	seq.AddStage("flush", func(ctx context.Context) error {
+		order = append(order, "flush")
+		return errFlush
+	})
+	seq.AddStage("persist", func(ctx context.Context) error {
+		order = append(order, "persist")
+		return nil
+	})
+	err := seq.Run()
+	if !errors.Is(err, errFlush) {
+		t.Errorf("Expected %v but got %v", errFlush, err)
+	}
+	if expected := []string{"drain", "flush"}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected stages %v to run but got %v", expected, order)
+	}
+}
+
+func TestSequencePhaserParent(t *testing.T) {
+	root := FromContext(context.Background())
+	seq := NewSequence(context.WithValue(root, testKey{}, "value"))
+	finished := false
+	seq.AddStage("drain", func(ctx context.Context) error {
+		if n := len(root.liveChildren()); n != 1 {
+			t.Errorf("Expected the stage to be a child of root but root has %d children", n)
+		}
+		if v := ctx.Value(testKey{}); v != "value" {
+			t.Errorf("Expected stage to carry values from parent but got %v", v)
+		}
+		// Shutdown of root waits for the running stage.
+		root.Cancel()
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		assertContextAlive(t, root)
+		finished = true
+		return nil
+	})
+	if err := seq.Run(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	<-root.Done()
+	if !finished {
+		t.Errorf("Expected root to finish after the stage")
+	}
+}
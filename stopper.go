@@ -0,0 +1,20 @@
+package phase
+
+import "context"
+
+// Stopper is implemented by subsystems which already have a method to stop
+// them, for use with Attach.
+type Stopper interface {
+	Stop(ctx context.Context) error
+}
+
+// Attach ties s to the lifecycle of p, so that a subsystem need not know
+// about Phasers. Once p's context is done s.Stop is called, after which p is
+// cancelled, closing it. Any error from Stop is discarded; wrap s to handle it.
+func Attach(p *Phaser, s Stopper) {
+	spawn(func() {
+		<-p.Done()
+		_ = s.Stop(context.Background())
+		p.Cancel()
+	})
+}
@@ -0,0 +1,44 @@
+package phase
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+type fakeStopper struct {
+	mu          sync.Mutex
+	p           *Phaser
+	calls       int
+	closedFirst bool
+}
+
+func (s *fakeStopper) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	select {
+	case <-s.p.closedCh:
+		s.closedFirst = true
+	default:
+	}
+	return nil
+}
+
+func TestAttach(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	s := &fakeStopper{p: p1}
+	Attach(p1, s)
+
+	p0.CancelAndWait()
+	<-p1.closedCh
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.calls != 1 {
+		t.Errorf("Expected Stop to be called once but got %d calls", s.calls)
+	}
+	if s.closedFirst {
+		t.Errorf("Expected Stop to be called before the Phaser closed")
+	}
+}
@@ -0,0 +1,36 @@
+package phase
+
+import "time"
+
+// Ticker is a time.Ticker tied to a Phaser, for loops which run until
+// shutdown. It is registered as a child of the Phaser, so the Phaser waits
+// for the loop to call Stop, and it stops ticking once shutdown begins.
+type Ticker struct {
+	// C delivers the ticks, as for time.Ticker.
+	C <-chan time.Time
+
+	ticker *time.Ticker
+	child  *Phaser
+}
+
+// NewTicker returns a Ticker which ticks every d until p is cancelled. The
+// loop receiving from C should also select on Done, and call Stop as it
+// exits.
+func NewTicker(p *Phaser, d time.Duration) *Ticker {
+	t := &Ticker{ticker: time.NewTicker(d), child: p.Next()}
+	t.C = t.ticker.C
+	t.child.AfterDone(t.ticker.Stop)
+	return t
+}
+
+// Done returns a channel which is closed once the Ticker has stopped ticking
+// because its Phaser was cancelled.
+func (t *Ticker) Done() <-chan struct{} {
+	return t.child.Done()
+}
+
+// Stop stops the Ticker and releases the Phaser from waiting for it.
+func (t *Ticker) Stop() {
+	t.ticker.Stop()
+	t.child.Cancel()
+}
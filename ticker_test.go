@@ -0,0 +1,48 @@
+package phase
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTicker(t *testing.T) {
+	p0 := FromContext(context.Background())
+	ticker := NewTicker(p0, time.Millisecond)
+	var ticks int32
+	var exited int32
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				atomic.AddInt32(&ticks, 1)
+			case <-ticker.Done():
+				// Finish the loop's work before releasing the Phaser.
+				time.Sleep(10 * time.Millisecond)
+				atomic.StoreInt32(&exited, 1)
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&ticks) == 0 {
+		t.Errorf("Expected ticks before cancellation")
+	}
+
+	p0.CancelAndWait()
+	if atomic.LoadInt32(&exited) == 0 {
+		t.Errorf("Expected Phaser to wait for the loop to exit")
+	}
+	// Drain a tick which may have been sent before the ticker stopped.
+	select {
+	case <-ticker.C:
+	default:
+	}
+	select {
+	case <-ticker.C:
+		t.Errorf("Expected no ticks after the Phaser was cancelled")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
@@ -0,0 +1,293 @@
+package phase
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// label identifies a Phaser by name, or by address if it is unnamed.
+func (p *Phaser) label() string {
+	if name := p.Name(); name != "" {
+		return name
+	}
+	return fmt.Sprintf("%p", p)
+}
+
+// Summary returns a one line description of the Phaser for logging, such as
+// "phase[web alive children=3 depth=2]". The state is alive, canceling once
+// cancellation has begun, or done once the Phaser's context is done.
+func (p *Phaser) Summary() string {
+	state := "alive"
+	if p.Err() != nil {
+		state = "done"
+	} else if !p.AcceptingChildren() {
+		state = "canceling"
+	}
+	return fmt.Sprintf("phase[%s %s children=%d depth=%d]", p.label(), state, len(p.liveChildren()), p.Depth())
+}
+
+// String returns the Summary of the Phaser.
+func (p *Phaser) String() string {
+	return p.Summary()
+}
+
+// ShutdownOrder returns the Phasers in the live tree under root in the order
+// they close during shutdown: each Phaser after all of its descendants, with
+// root last. Phasers are identified by name, or by address if unnamed.
+// Siblings created by NextPriority close in order of priority, lowest value
+// first. Siblings of the same priority close concurrently and are listed in
+// the order they were created. ShutdownOrder does not cancel anything.
+func ShutdownOrder(root *Phaser) []string {
+	var order []string
+	for _, p := range livePhasers(root) {
+		order = append(order, p.label())
+	}
+	return order
+}
+
+// ShutdownWithCallback cancels root and blocks until it has closed, calling
+// onClosed as each Phaser in its live tree closes, such as to drive a progress
+// display. Phasers are identified as for ShutdownOrder, and d is the time from
+// the start of the Phaser's cancellation until it closed. Calls are made one
+// at a time, each Phaser after all of its descendants, with root last.
+// Phasers other than root must be closed by their owners as usual.
+func ShutdownWithCallback(root *Phaser, onClosed func(name string, d time.Duration)) {
+	var mu sync.Mutex
+	reported := make(map[*Phaser]chan struct{})
+	live := livePhasers(root)
+	for _, p := range live {
+		reported[p] = make(chan struct{})
+	}
+	for _, p := range live {
+		p, kids := p, p.liveChildren()
+		p.mu.Lock()
+		closedCh := p.closedCh
+		p.mu.Unlock()
+		spawn(func() {
+			<-closedCh
+			d := time.Duration(0)
+			if at, ok := p.CanceledAt(); ok {
+				d = time.Since(at)
+			}
+			for _, child := range kids {
+				if ch, ok := reported[child]; ok {
+					<-ch
+				}
+			}
+			mu.Lock()
+			onClosed(p.label(), d)
+			mu.Unlock()
+			close(reported[p])
+		})
+	}
+	root.Cancel()
+	<-reported[root]
+}
+
+// livePhasers returns the Phasers in the live tree under root, each after its
+// descendants, and siblings in order of priority then creation.
+func livePhasers(root *Phaser) []*Phaser {
+	kids := root.liveChildren()
+	sort.SliceStable(kids, func(i, j int) bool {
+		return kids[i].priority < kids[j].priority
+	})
+	var live []*Phaser
+	for _, child := range kids {
+		live = append(live, livePhasers(child)...)
+	}
+	return append(live, root)
+}
+
+// PhaseSnapshot is a point in time view of a Phaser and its descendants,
+// suitable for encoding as JSON for a debug endpoint.
+type PhaseSnapshot struct {
+	Name                string          `json:"name"`
+	Reason              string          `json:"reason,omitempty"`
+	Done                bool            `json:"done"`
+	OutstandingChildren int             `json:"outstandingChildren"`
+	Children            []PhaseSnapshot `json:"children,omitempty"`
+}
+
+// Snapshot returns a snapshot of the Phaser and the live tree beneath it.
+// It is safe to call while the tree is changing.
+func (p *Phaser) Snapshot() PhaseSnapshot {
+	kids := p.liveChildren()
+	snap := PhaseSnapshot{
+		Name:                p.Name(),
+		Reason:              p.RegistrationReason(),
+		Done:                p.Err() != nil,
+		OutstandingChildren: len(kids),
+	}
+	for _, child := range kids {
+		snap.Children = append(snap.Children, child.Snapshot())
+	}
+	return snap
+}
+
+// ToDOT renders the Phaser and the live tree beneath it as a Graphviz DOT
+// digraph, with an edge from each Phaser to each of its children. Phasers are
+// labelled as for ShutdownOrder, and those whose context is done are drawn in
+// grey. The output can be rendered with, for example, dot -Tpng.
+func (p *Phaser) ToDOT() string {
+	var b strings.Builder
+	b.WriteString("digraph phase {\n")
+	n := 0
+	var visit func(p *Phaser) string
+	visit = func(p *Phaser) string {
+		id := "n" + strconv.Itoa(n)
+		n++
+		attrs := "label=" + strconv.Quote(p.label())
+		if p.Err() != nil {
+			attrs += ", color=grey, fontcolor=grey"
+		}
+		fmt.Fprintf(&b, "\t%s [%s];\n", id, attrs)
+		for _, child := range p.liveChildren() {
+			fmt.Fprintf(&b, "\t%s -> %s;\n", id, visit(child))
+		}
+		return id
+	}
+	visit(p)
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// AnyAlive reports whether the context of root, or of any Phaser in the live
+// tree beneath it, is not yet done. It suits a readiness probe which should
+// only report not ready once the entire tree has drained.
+func AnyAlive(root *Phaser) bool {
+	if root.Err() == nil {
+		return true
+	}
+	for _, child := range root.liveChildren() {
+		if AnyAlive(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// LastStanding returns a channel which is closed once the Phaser is the last
+// living member of its parent's subtree: all of its own children have closed
+// and it has no siblings which have not. For a root Phaser only its children
+// are considered. It suits a "last one out turns off the lights" cleanup. The
+// channel is closed at most once, even if children are created afterwards.
+func (p *Phaser) LastStanding() <-chan struct{} {
+	p.mu.Lock()
+	if p.lastCh == nil {
+		p.lastCh = make(chan struct{})
+	}
+	ch := p.lastCh
+	p.mu.Unlock()
+	p.checkLastStanding()
+	return ch
+}
+
+// checkLastStanding closes the channel returned by LastStanding if the
+// Phaser has become the last living member of its parent's subtree.
+func (p *Phaser) checkLastStanding() {
+	p.mu.Lock()
+	waiting := p.lastCh != nil && !p.lastFired && len(p.kids) == 0
+	p.mu.Unlock()
+	if !waiting {
+		return
+	}
+	if p.parent != nil {
+		p.parent.mu.Lock()
+		_, live := p.parent.kids[p]
+		alone := live && len(p.parent.kids) == 1
+		p.parent.mu.Unlock()
+		if !alone {
+			return
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.lastFired {
+		p.lastFired = true
+		close(p.lastCh)
+	}
+}
+
+// CancelLeaves cancels the Phasers in the live tree under root which have no
+// children, leaving the rest of the tree running. It quiesces the deepest
+// workers, such as for a rolling restart of a worker pool, without a full
+// shutdown. If root has no children it is itself cancelled.
+func CancelLeaves(root *Phaser) {
+	kids := root.liveChildren()
+	if len(kids) == 0 {
+		root.Cancel()
+		return
+	}
+	for _, child := range kids {
+		CancelLeaves(child)
+	}
+}
+
+// WaitForPhase blocks until the context of the Phaser named name, in the live
+// tree under root and including root, is done. It returns false at once if
+// there is no such Phaser. Where several Phasers share a name, the first
+// found in creation order, each Phaser before its children, is waited for.
+// It suits staged shutdown which must wait for one subsystem before moving
+// on.
+func WaitForPhase(root *Phaser, name string) bool {
+	var find func(p *Phaser) *Phaser
+	find = func(p *Phaser) *Phaser {
+		if p.Name() == name {
+			return p
+		}
+		for _, child := range p.liveChildren() {
+			if found := find(child); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	p := find(root)
+	if p == nil {
+		return false
+	}
+	<-p.Done()
+	return true
+}
+
+// CauseTree returns the cancellation cause of each named Phaser in the live
+// tree under root, including root, keyed by name. The cause of a Phaser which
+// has begun cancellation is reported even if it is still waiting for its
+// children; that of a Phaser which has not is nil. Where several Phasers share
+// a name, the last one visited in creation order is reported.
+func CauseTree(root *Phaser) map[string]error {
+	causes := make(map[string]error)
+	var visit func(p *Phaser)
+	visit = func(p *Phaser) {
+		if name := p.Name(); name != "" {
+			causes[name] = p.cancelCause()
+		}
+		for _, child := range p.liveChildren() {
+			visit(child)
+		}
+	}
+	visit(root)
+	return causes
+}
+
+// cancelCause returns the cause with which the Phaser's cancellation began,
+// which context.Cause reports once its context is done, or nil.
+func (p *Phaser) cancelCause() error {
+	if err := context.Cause(p.ctx); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.canceling {
+		return nil
+	}
+	if p.cause == nil {
+		return context.Canceled
+	}
+	return p.cause
+}
@@ -0,0 +1,369 @@
+package phase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdownOrder(t *testing.T) {
+	root := FromContext(context.Background(), WithName("root"))
+	web := root.Next(WithName("web"))
+	web.Next(WithName("handler"))
+	pipeline := root.Next(WithName("pipeline"))
+	pipeline.Next(WithName("db"))
+
+	expected := []string{"handler", "web", "db", "pipeline", "root"}
+	if order := ShutdownOrder(root); !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected shutdown order %v but got %v", expected, order)
+	}
+	assertContextAlive(t, root)
+}
+
+func TestShutdownOrderPriority(t *testing.T) {
+	root := FromContext(context.Background())
+	a := root.NextPriority(2, WithName("a"))
+	b := root.NextPriority(1, WithName("b"))
+	c := root.Next(WithName("c"))
+
+	expected := []string{"c", "b", "a"}
+	order := ShutdownOrder(root)
+	if !reflect.DeepEqual(order[:3], expected) {
+		t.Errorf("Expected shutdown order %v but got %v", expected, order)
+	}
+
+	// The order matches that in which the siblings actually close.
+	var mu sync.Mutex
+	var closed []string
+	for _, p := range []*Phaser{a, b, c} {
+		p := p
+		go func() {
+			<-p.Done()
+			mu.Lock()
+			closed = append(closed, p.Name())
+			mu.Unlock()
+			p.Cancel()
+		}()
+	}
+	root.CancelAndWait()
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(closed, expected) {
+		t.Errorf("Expected siblings to close in order %v but got %v", expected, closed)
+	}
+}
+
+func TestShutdownOrderExcludesClosed(t *testing.T) {
+	root := FromContext(context.Background(), WithName("root"))
+	closed := root.Next(WithName("closed"))
+	root.Next(WithName("open"))
+	closed.Cancel()
+	<-closed.Done()
+	// The parent is notified shortly after the child's context is done.
+	for i := 0; i < 100 && len(root.liveChildren()) != 1; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	expected := []string{"open", "root"}
+	if order := ShutdownOrder(root); !reflect.DeepEqual(order, expected) {
+		t.Errorf("Expected shutdown order %v but got %v", expected, order)
+	}
+}
+
+func TestSnapshotJSON(t *testing.T) {
+	root := FromContext(context.Background(), WithName("root"))
+	web := root.Next(WithName("web"))
+	web.Next(WithName("conn"), WithReason("client 10.0.0.1"))
+	root.Next(WithName("db"))
+
+	b, err := json.Marshal(root.Snapshot())
+	if err != nil {
+		t.Fatalf("Unexpected error marshaling snapshot: %v", err)
+	}
+	expected := `{"name":"root","done":false,"outstandingChildren":2,"children":[` +
+		`{"name":"web","done":false,"outstandingChildren":1,"children":[` +
+		`{"name":"conn","reason":"client 10.0.0.1","done":false,"outstandingChildren":0}]},` +
+		`{"name":"db","done":false,"outstandingChildren":0}]}`
+	if string(b) != expected {
+		t.Errorf("Unexpected snapshot JSON\n got: %s\nwant: %s", b, expected)
+	}
+}
+
+func TestToDOT(t *testing.T) {
+	root := FromContext(context.Background(), WithName("root"))
+	web := root.Next(WithName("web"))
+	web.AutoClose()
+	web.Next(WithName("handler")).AutoClose()
+	db := root.Next(WithName("db"))
+	db.Cancel()
+	<-db.Done()
+
+	// The closing child remains in the tree until its parent is notified,
+	// which makes the output racy, so wait for it to be removed.
+	for i := 0; i < 100 && len(root.liveChildren()) != 1; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	expected := "digraph phase {\n" +
+		"\tn0 [label=\"root\"];\n" +
+		"\tn1 [label=\"web\"];\n" +
+		"\tn2 [label=\"handler\"];\n" +
+		"\tn1 -> n2;\n" +
+		"\tn0 -> n1;\n" +
+		"}\n"
+	if dot := root.ToDOT(); dot != expected {
+		t.Errorf("Unexpected DOT output\n got: %s\nwant: %s", dot, expected)
+	}
+
+	root.CancelAndWait()
+	if dot := root.ToDOT(); !strings.Contains(dot, `n0 [label="root", color=grey, fontcolor=grey];`) {
+		t.Errorf("Expected done Phaser to be drawn in grey but got %s", dot)
+	}
+}
+
+func TestAnyAlive(t *testing.T) {
+	root := FromContext(context.Background())
+	root.AutoClose()
+	web := root.Next()
+	web.AutoClose()
+	db := web.Next()
+	web.Cancel()
+	// web waits for db, which is still alive, while root is unaffected.
+	if !AnyAlive(root) {
+		t.Errorf("Expected the tree to be alive")
+	}
+	if !AnyAlive(web) {
+		t.Errorf("Expected web's subtree to be alive while db runs")
+	}
+
+	root.Cancel()
+	db.Cancel()
+	<-root.Done()
+	if AnyAlive(root) {
+		t.Errorf("Expected no Phaser to be alive once the tree has closed")
+	}
+}
+
+func TestCancelLeaves(t *testing.T) {
+	root := FromContext(context.Background())
+	web := root.Next()
+	handler := web.Next()
+	db := root.Next()
+
+	CancelLeaves(root)
+	<-handler.Done()
+	<-db.Done()
+	assertContextAlive(t, root)
+	assertContextAlive(t, web)
+
+	web.Cancel()
+	root.CancelAndWait()
+}
+
+func TestSnapshotSetName(t *testing.T) {
+	root := FromContext(context.Background(), WithName("root"))
+	worker := root.Next(WithName("worker"))
+	done := make(chan struct{})
+	go func() {
+		// A concurrent snapshot must not race with the rename.
+		defer close(done)
+		root.Snapshot()
+	}()
+	worker.SetName("worker: job 42")
+	<-done
+
+	if name := root.Snapshot().Children[0].Name; name != "worker: job 42" {
+		t.Errorf("Expected renamed worker in snapshot but got %q", name)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	root := FromContext(context.Background(), WithName("root"))
+	web := root.Next(WithName("web"))
+	web.AutoClose()
+	handlers := []*Phaser{web.Next(), web.Next(), web.Next()}
+	if s := web.String(); s != "phase[web alive children=3 depth=1]" {
+		t.Errorf("Unexpected summary %q", s)
+	}
+
+	root.Cancel()
+	handlers[0].Cancel()
+	for i := 0; i < 100 && (len(web.liveChildren()) != 2 || web.AcceptingChildren()); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if s := web.Summary(); s != "phase[web canceling children=2 depth=1]" {
+		t.Errorf("Unexpected summary %q", s)
+	}
+
+	handlers[1].Cancel()
+	handlers[2].Cancel()
+	<-root.Done()
+	if s := web.Summary(); s != "phase[web done children=0 depth=1]" {
+		t.Errorf("Unexpected summary %q", s)
+	}
+}
+
+func TestCauseTree(t *testing.T) {
+	errReload := errors.New("config reload")
+	errShutdown := errors.New("shutdown")
+	root := FromContext(context.Background(), WithName("root"))
+	web := root.Next(WithName("web"))
+	// handler keeps web waiting, so web remains in the tree.
+	handler := web.Next(WithName("handler"))
+	cache, cancel := root.NextTimeout(time.Millisecond, WithName("cache"))
+	defer cancel()
+	db := root.Next(WithName("db"))
+	root.Next() // Unnamed Phasers are not reported.
+
+	web.CancelWithCause(errReload)
+	<-handler.Done()
+	<-cache.Done()
+	expected := map[string]error{
+		"root":    nil,
+		"web":     errReload,
+		"handler": errReload,
+		"cache":   context.DeadlineExceeded,
+		"db":      nil,
+	}
+	if causes := CauseTree(root); !reflect.DeepEqual(causes, expected) {
+		t.Errorf("Expected causes %v but got %v", expected, causes)
+	}
+
+	root.CancelWithCause(errShutdown)
+	<-db.Done()
+	if cause := CauseTree(root)["db"]; cause != errShutdown {
+		t.Errorf("Expected db to report %v but got %v", errShutdown, cause)
+	}
+	handler.Cancel()
+	cache.Cancel()
+	db.Cancel()
+}
+
+func TestLastStanding(t *testing.T) {
+	// p0 has children a and b, and a has a child c.
+	p0 := FromContext(context.Background())
+	a := p0.Next(WithName("a"))
+	b := p0.Next(WithName("b"))
+	c := a.Next(WithName("c"))
+	last := map[string]<-chan struct{}{
+		"p0": p0.LastStanding(),
+		"a":  a.LastStanding(),
+		"b":  b.LastStanding(),
+		"c":  c.LastStanding(),
+	}
+	assertFired := func(step string, expected ...string) {
+		t.Helper()
+		fired := map[string]bool{}
+		for name, ch := range last {
+			select {
+			case <-ch:
+				fired[name] = true
+			default:
+			}
+		}
+		for _, name := range expected {
+			if !fired[name] {
+				t.Errorf("%s: Expected %s to be last standing", step, name)
+			}
+			delete(fired, name)
+		}
+		for name := range fired {
+			t.Errorf("%s: Unexpected %s to be last standing", step, name)
+		}
+	}
+	// c has no children or siblings.
+	assertFired("start", "c")
+
+	b.Cancel()
+	<-b.closedCh
+	// a has no siblings but still has its child.
+	assertFired("b closed", "c")
+
+	c.Cancel()
+	<-c.closedCh
+	assertFired("c closed", "a", "c")
+
+	a.Cancel()
+	<-a.closedCh
+	assertFired("a closed", "a", "c", "p0")
+	p0.Cancel()
+}
+
+func TestShutdownWithCallback(t *testing.T) {
+	p0 := FromContext(context.Background(), WithName("root"))
+	db := p0.Next(WithName("db"))
+	web := p0.Next(WithName("web"))
+	handler := web.Next(WithName("handler"))
+	for _, p := range []*Phaser{db, web, handler} {
+		p := p
+		go func() {
+			<-p.Done()
+			time.Sleep(5 * time.Millisecond)
+			p.Cancel()
+		}()
+	}
+
+	var order []string
+	durations := map[string]time.Duration{}
+	ShutdownWithCallback(p0, func(name string, d time.Duration) {
+		order = append(order, name)
+		durations[name] = d
+	})
+
+	pos := map[string]int{}
+	for i, name := range order {
+		pos[name] = i
+	}
+	if len(order) != 4 || pos["handler"] > pos["web"] || order[3] != "root" {
+		t.Errorf("Expected each Phaser after its descendants but got %v", order)
+	}
+	if d := durations["root"]; d < 10*time.Millisecond || d > time.Second {
+		t.Errorf("Implausible shutdown duration for root: %v", d)
+	}
+	if d := durations["handler"]; d < 5*time.Millisecond || d > durations["root"] {
+		t.Errorf("Implausible shutdown duration for handler: %v", d)
+	}
+}
+
+func TestWaitForPhase(t *testing.T) {
+	p0 := FromContext(context.Background(), WithName("root"))
+	web := p0.Next(WithName("web"))
+	db := web.Next(WithName("db"))
+	db.AutoClose()
+	web.AutoClose()
+
+	waited := make(chan bool)
+	go func() {
+		waited <- WaitForPhase(p0, "db")
+	}()
+	select {
+	case <-waited:
+		t.Fatalf("Expected WaitForPhase to block until db is done")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	web.Cancel()
+	select {
+	case ok := <-waited:
+		if !ok {
+			t.Errorf("Expected db to be found")
+		}
+		assertContextFinished(t, db)
+	case <-time.After(time.Second):
+		t.Fatalf("Expected WaitForPhase to return once db is done")
+	}
+	p0.CancelAndWait()
+	<-p0.closedCh
+}
+
+func TestWaitForPhaseNotFound(t *testing.T) {
+	p0 := FromContext(context.Background())
+	defer p0.Cancel()
+	if WaitForPhase(p0, "missing") {
+		t.Errorf("Expected no Phaser to be found")
+	}
+}
@@ -0,0 +1,127 @@
+package phase
+
+import "context"
+
+// Key is a context key for use with WithValue and Value. Each Key returned by
+// NewKey is distinct from every other, even one with the same name, so keys
+// cannot collide as bare strings can.
+type Key struct {
+	k *key
+}
+
+type key struct {
+	name string
+}
+
+// NewKey returns a new Key. The name is only used to describe it.
+func NewKey(name string) Key {
+	return Key{&key{name: name}}
+}
+
+// String returns the name of the Key.
+func (k Key) String() string {
+	return k.k.name
+}
+
+// WithValue returns a copy of ctx in which the value associated with key is val.
+// It is a typed wrapper around context.WithValue for use with Value.
+func WithValue[T any](ctx context.Context, key any, val T) context.Context {
+	return context.WithValue(ctx, key, val)
+}
+
+// Value returns the value associated with key in ctx, and whether a value of
+// type T was found. It reports false when the key is absent or holds a value
+// of a different type, rather than panicking like an unchecked type assertion.
+func Value[T any](ctx context.Context, key any) (T, bool) {
+	val, ok := ctx.Value(key).(T)
+	return val, ok
+}
+
+// CurrentPhaseName returns the name of the nearest Phaser in ctx, allowing
+// code which only has a context to tell which phase it is running under.
+// It returns false if ctx was not derived from a Phaser.
+func CurrentPhaseName(ctx context.Context) (string, bool) {
+	p := ancestor(ctx)
+	if p == nil {
+		return "", false
+	}
+	return p.Name(), true
+}
+
+// AncestorByName returns the nearest Phaser in ctx with the given name,
+// searching from the nearest Phaser up through its parents. It returns nil
+// if there is no such Phaser.
+func AncestorByName(ctx context.Context, name string) *Phaser {
+	for p := ancestor(ctx); p != nil; p = p.parent {
+		if p.Name() == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// TraceID returns the correlation ID given to the nearest Phaser in ctx with
+// NextWithTraceID, or inherited by it from its parents. It returns an empty
+// string if there is none.
+func TraceID(ctx context.Context) string {
+	for p := ancestor(ctx); p != nil; p = p.parent {
+		if p.traceID != "" {
+			return p.traceID
+		}
+	}
+	return ""
+}
+
+// SetLocal associates val with key on the Phaser alone. Unlike a context
+// value it is not visible to the Phaser's children, or through Value, so suits
+// bookkeeping which is private to one phase.
+func (p *Phaser) SetLocal(key, val any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.locals == nil {
+		p.locals = make(map[any]any)
+	}
+	p.locals[key] = val
+}
+
+// GetLocal returns the value associated with key by SetLocal, and whether
+// there is one.
+func (p *Phaser) GetLocal(key any) (any, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	val, ok := p.locals[key]
+	return val, ok
+}
+
+// FindPhaser returns the nearest Phaser in ctx, or nil if there is none.
+// It relies on context wrappers delegating Value for keys they do not
+// recognise to the context they wrap, as those of the context package do.
+// A wrapper which does not is searched through its Unwrap method, if it has
+// one returning the wrapped context; otherwise the Phaser cannot be found.
+// Every function of this package which finds a Phaser in a context, such as
+// Adopt, Logger and TraceID, searches in the same way.
+func FindPhaser(ctx context.Context) *Phaser {
+	return ancestor(ctx)
+}
+
+// RegisterCleanup arranges for fn to run once the context of the nearest
+// Phaser in ctx is done, as AfterDone does, so that code deep in a call chain
+// can clean up on shutdown without being passed the Phaser. It returns
+// ErrNoPhaser if ctx was not derived from a Phaser.
+func RegisterCleanup(ctx context.Context, fn func()) error {
+	p := FindPhaser(ctx)
+	if p == nil {
+		return ErrNoPhaser
+	}
+	p.AfterDone(fn)
+	return nil
+}
+
+// Adopt returns the nearest Phaser in ctx, and true, so that library code
+// given only a context can join the caller's phase rather than creating a
+// redundant Phaser of its own. It returns nil and false if ctx was not derived
+// from a Phaser, leaving the caller to decide whether to create one.
+func Adopt(ctx context.Context) (*Phaser, bool) {
+	p := ancestor(ctx)
+	return p, p != nil
+}
@@ -0,0 +1,275 @@
+package phase
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type testKey struct{}
+
+func TestValuePresent(t *testing.T) {
+	p0 := FromContext(WithValue(context.Background(), testKey{}, 42))
+	ctx := WithValue(p0, "other", "x")
+	if v, ok := Value[int](ctx, testKey{}); !ok || v != 42 {
+		t.Errorf("Expected 42, true but got %v, %v", v, ok)
+	}
+}
+
+func TestValueAbsent(t *testing.T) {
+	p0 := FromContext(context.Background())
+	if v, ok := Value[int](p0, testKey{}); ok || v != 0 {
+		t.Errorf("Expected 0, false but got %v, %v", v, ok)
+	}
+}
+
+func TestValueWrongType(t *testing.T) {
+	p0 := FromContext(context.Background())
+	ctx := WithValue(p0, testKey{}, "not an int")
+	if v, ok := Value[int](ctx, testKey{}); ok || v != 0 {
+		t.Errorf("Expected 0, false but got %v, %v", v, ok)
+	}
+}
+
+func TestKey(t *testing.T) {
+	k1, k2 := NewKey("id"), NewKey("id")
+	ctx := WithValue(context.Background(), k1, 1)
+	ctx = WithValue(ctx, k2, 2)
+	p0 := FromContext(ctx)
+	if v, ok := Value[int](p0.Next(), k1); !ok || v != 1 {
+		t.Errorf("Expected 1, true but got %v, %v", v, ok)
+	}
+	if v, ok := Value[int](p0.Next(), k2); !ok || v != 2 {
+		t.Errorf("Expected 2, true but got %v, %v", v, ok)
+	}
+	if k1.String() != "id" {
+		t.Errorf("Expected key name id but got %q", k1.String())
+	}
+}
+
+func TestCurrentPhaseName(t *testing.T) {
+	p0 := FromContext(context.Background(), WithName("web"))
+	if name, ok := CurrentPhaseName(p0); !ok || name != "web" {
+		t.Errorf("Expected web, true but got %q, %v", name, ok)
+	}
+
+	// An intermediate context does not hide the phaser.
+	p1 := p0.Next(WithName("handler"))
+	ctx := context.WithValue(p1, testKey{}, "x")
+	if name, ok := CurrentPhaseName(ctx); !ok || name != "handler" {
+		t.Errorf("Expected handler, true but got %q, %v", name, ok)
+	}
+}
+
+func TestCurrentPhaseNameNotFound(t *testing.T) {
+	if name, ok := CurrentPhaseName(context.Background()); ok || name != "" {
+		t.Errorf("Expected empty name, false but got %q, %v", name, ok)
+	}
+}
+
+func TestValueNested(t *testing.T) {
+	p0 := FromContext(WithValue(context.Background(), testKey{}, "root value"))
+	p2 := p0.Next().Next()
+	if v, ok := Value[string](p2, testKey{}); !ok || v != "root value" {
+		t.Errorf("Expected nested phaser to inherit upstream value but got %q, %v", v, ok)
+	}
+}
+
+func TestAncestorByName(t *testing.T) {
+	root := FromContext(context.Background(), WithName("root"))
+	web := root.Next(WithName("web"))
+	handler := web.Next(WithName("handler"))
+	ctx := context.WithValue(handler.Next(), testKey{}, "x")
+
+	for _, name := range []string{"root", "web", "handler"} {
+		if p := AncestorByName(ctx, name); p == nil || p.Name() != name {
+			t.Errorf("Expected to find ancestor %s but got %v", name, p)
+		}
+	}
+	if p := AncestorByName(ctx, "db"); p != nil {
+		t.Errorf("Expected no ancestor named db but got %v", p)
+	}
+	if p := AncestorByName(context.Background(), "root"); p != nil {
+		t.Errorf("Expected no ancestor without a phaser but got %v", p)
+	}
+}
+
+func TestAdopt(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	ctx := context.WithValue(p1, testKey{}, "x")
+	if p, ok := Adopt(ctx); !ok || p != p1 {
+		t.Errorf("Expected to adopt the nearest phaser but got %v, %v", p, ok)
+	}
+}
+
+func TestRegisterCleanup(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p1 := p0.Next()
+	ctx := context.WithValue(p1, testKey{}, "x")
+	ran := make(chan struct{})
+	if err := RegisterCleanup(ctx, func() { close(ran) }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The cleanup belongs to p1, so runs before p0 is cancelled.
+	p1.Cancel()
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected cleanup to run once p1 is done")
+	}
+	p0.Cancel()
+}
+
+func TestRegisterCleanupNoPhaser(t *testing.T) {
+	if err := RegisterCleanup(context.Background(), func() {}); err != ErrNoPhaser {
+		t.Errorf("Expected ErrNoPhaser but got %v", err)
+	}
+}
+
+func TestAdoptNoPhaser(t *testing.T) {
+	if p, ok := Adopt(context.Background()); ok || p != nil {
+		t.Errorf("Expected nil, false but got %v, %v", p, ok)
+	}
+}
+
+func TestTraceID(t *testing.T) {
+	root := FromContext(context.Background())
+	if id := TraceID(root); id != "" {
+		t.Errorf("Expected no trace ID but got %q", id)
+	}
+	web := root.NextWithTraceID("req-1")
+	handler := web.Next()
+	ctx := context.WithValue(handler, testKey{}, "x")
+	if id := TraceID(ctx); id != "req-1" {
+		t.Errorf("Expected inherited trace ID req-1 but got %q", id)
+	}
+
+	// A descendant may set its own.
+	db := handler.NextWithTraceID("req-2")
+	if id := TraceID(db.Next()); id != "req-2" {
+		t.Errorf("Expected overridden trace ID req-2 but got %q", id)
+	}
+	if id := TraceID(handler); id != "req-1" {
+		t.Errorf("Expected parent trace ID to be unchanged but got %q", id)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	p0 := FromContext(context.Background())
+	p0.SetLocal(testKey{}, "local")
+	if v, ok := p0.GetLocal(testKey{}); !ok || v != "local" {
+		t.Errorf("Expected local value but got %v, %v", v, ok)
+	}
+	if v := p0.Value(testKey{}); v != nil {
+		t.Errorf("Expected local value to be hidden from Value but got %v", v)
+	}
+
+	p1 := p0.Next()
+	if v := p1.Value(testKey{}); v != nil {
+		t.Errorf("Expected local value to be hidden from children but got %v", v)
+	}
+	if v, ok := p1.GetLocal(testKey{}); ok {
+		t.Errorf("Expected no local value on the child but got %v", v)
+	}
+}
+
+// delegatingContext wraps a context, correctly delegating Value.
+type delegatingContext struct {
+	context.Context
+}
+
+// swallowingContext wraps a context but hides all of its values.
+type swallowingContext struct {
+	context.Context
+}
+
+func (swallowingContext) Value(key any) any {
+	return nil
+}
+
+// unwrappingContext hides values like swallowingContext but can be unwrapped.
+type unwrappingContext struct {
+	swallowingContext
+}
+
+func (c unwrappingContext) Unwrap() context.Context {
+	return c.Context
+}
+
+func TestFindPhaser(t *testing.T) {
+	p0 := FromContext(context.Background())
+	if p := FindPhaser(delegatingContext{p0}); p != p0 {
+		t.Errorf("Expected to find phaser through a delegating wrapper but got %v", p)
+	}
+	if p := FindPhaser(unwrappingContext{swallowingContext{p0}}); p != p0 {
+		t.Errorf("Expected to find phaser by unwrapping but got %v", p)
+	}
+	if p := FindPhaser(swallowingContext{p0}); p != nil {
+		t.Errorf("Expected a wrapper hiding values to hide the phaser but got %v", p)
+	}
+	if p := FindPhaser(context.Background()); p != nil {
+		t.Errorf("Expected no phaser but got %v", p)
+	}
+}
+
+func TestLookupsUnwrap(t *testing.T) {
+	p0 := FromContext(context.Background(), WithName("root"))
+	ctx := unwrappingContext{swallowingContext{p0}}
+	if p, ok := Adopt(ctx); !ok || p != p0 {
+		t.Errorf("Expected Adopt to find phaser by unwrapping but got %v", p)
+	}
+	if name, ok := CurrentPhaseName(ctx); !ok || name != "root" {
+		t.Errorf("Expected phase name root but got %q", name)
+	}
+	if p := AncestorByName(ctx, "root"); p != p0 {
+		t.Errorf("Expected AncestorByName to find phaser by unwrapping but got %v", p)
+	}
+}
+
+func TestNextWithValues(t *testing.T) {
+	type dbKey struct{}
+	p0 := FromContext(WithValue(context.Background(), testKey{}, "upstream"), WithName("root"))
+	p1 := p0.NextWithValues(map[any]any{dbKey{}: "db", "config": 42}, WithName("service"))
+	p2 := p1.Next()
+
+	if v, ok := Value[string](p2, dbKey{}); !ok || v != "db" {
+		t.Errorf("Expected injected db value but got %q, %v", v, ok)
+	}
+	if v, ok := Value[int](p2, "config"); !ok || v != 42 {
+		t.Errorf("Expected injected config value but got %v, %v", v, ok)
+	}
+	if v, ok := Value[string](p2, testKey{}); !ok || v != "upstream" {
+		t.Errorf("Expected upstream value but got %q, %v", v, ok)
+	}
+	if p, ok := Adopt(p1); !ok || p != p1 {
+		t.Errorf("Expected to find the child itself but got %v", p)
+	}
+	if p := AncestorByName(p2, "root"); p != p0 {
+		t.Errorf("Expected ancestry to resolve to the root but got %v", p)
+	}
+}
+
+func BenchmarkAdopt(b *testing.B) {
+	p0 := FromContext(context.Background())
+	defer p0.Cancel()
+	px := p0
+	for i := 0; i < 20; i++ {
+		px = px.Next()
+	}
+	wrapped := context.Context(px)
+	for i := 0; i < 20; i++ {
+		wrapped = context.WithValue(wrapped, testKey{}, i)
+	}
+	b.Run("phaser", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Adopt(px)
+		}
+	})
+	b.Run("wrapped", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			Adopt(wrapped)
+		}
+	})
+}
@@ -0,0 +1,33 @@
+package phase
+
+import "context"
+
+// WaitAll cancels each of the Phasers and waits until all of them have
+// finished, which includes all of their descendants closing. It is intended
+// for programs with several independent root Phasers.
+func WaitAll(phasers ...*Phaser) {
+	_ = WaitAllContext(context.Background(), phasers...)
+}
+
+// Barrier cancels all of the Phasers together, so that peers with no
+// dependency on one another shut down in parallel rather than in sequence,
+// and waits until all of them have finished. It is equivalent to WaitAll.
+func Barrier(phasers ...*Phaser) {
+	WaitAll(phasers...)
+}
+
+// WaitAllContext is like WaitAll but stops waiting when ctx is done,
+// returning its error. The Phasers remain cancelled.
+func WaitAllContext(ctx context.Context, phasers ...*Phaser) error {
+	for _, p := range phasers {
+		p.Cancel()
+	}
+	for _, p := range phasers {
+		select {
+		case <-p.Done():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
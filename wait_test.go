@@ -0,0 +1,82 @@
+package phase
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// slowRoots returns three root Phasers, the second of which has a child
+// that takes delay to close after cancellation.
+func slowRoots(delay time.Duration) []*Phaser {
+	roots := []*Phaser{New(), New(), New()}
+	slow := roots[1].Next()
+	go func() {
+		<-slow.Done()
+		time.Sleep(delay)
+		slow.Cancel()
+	}()
+	return roots
+}
+
+func TestWaitAll(t *testing.T) {
+	roots := slowRoots(20 * time.Millisecond)
+	start := time.Now()
+	WaitAll(roots...)
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected WaitAll to block for slow root but returned after %v", elapsed)
+	}
+	for _, p := range roots {
+		assertContextFinished(t, p)
+	}
+}
+
+func TestWaitAllContextTimeout(t *testing.T) {
+	roots := slowRoots(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := WaitAllContext(ctx, roots...); err != context.DeadlineExceeded {
+		t.Errorf("Expected %v but got %v", context.DeadlineExceeded, err)
+	}
+	assertContextAlive(t, roots[1])
+	<-roots[1].Done()
+}
+
+func TestBarrier(t *testing.T) {
+	peers := []*Phaser{New(), New(), New()}
+	doneAt := make(chan time.Time, len(peers))
+	for _, peer := range peers {
+		child := peer.Next()
+		go func() {
+			<-child.Done()
+			doneAt <- time.Now()
+			time.Sleep(10 * time.Millisecond)
+			child.Cancel()
+		}()
+	}
+
+	start := time.Now()
+	Barrier(peers...)
+	if elapsed := time.Since(start); elapsed < 10*time.Millisecond {
+		t.Errorf("Expected Barrier to wait for children but returned after %v", elapsed)
+	}
+	for _, peer := range peers {
+		assertContextFinished(t, peer)
+	}
+
+	// All peers were triggered together rather than one after another.
+	first := <-doneAt
+	last := first
+	for i := 1; i < len(peers); i++ {
+		at := <-doneAt
+		if at.Before(first) {
+			first = at
+		}
+		if at.After(last) {
+			last = at
+		}
+	}
+	if spread := last.Sub(first); spread > 5*time.Millisecond {
+		t.Errorf("Expected peers to be cancelled together but spread was %v", spread)
+	}
+}
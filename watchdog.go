@@ -0,0 +1,57 @@
+package phase
+
+import (
+	"sync"
+	"time"
+)
+
+// StartWatchdog watches the shutdown of the tree under root, calling report
+// if the number of live Phasers in it stops decreasing for stallTimeout, as
+// when application code leaves two Phasers waiting on each other. report is
+// passed the live Phasers, each after its descendants as in ShutdownOrder;
+// with debugging enabled their CreationStack and WaitStack show where they
+// came from. report is called once per stall, and the watchdog stops once
+// root is done or the returned stop function is called. StartWatchdog panics
+// if stallTimeout is not positive.
+func StartWatchdog(root *Phaser, stallTimeout time.Duration, report func(stalled []*Phaser)) (stop func()) {
+	if stallTimeout <= 0 {
+		panic("phase: non-positive stall timeout for StartWatchdog")
+	}
+	interval := stallTimeout / 4
+	if interval <= 0 {
+		interval = stallTimeout
+	}
+	stopCh := make(chan struct{})
+	spawn(func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		last, lastChange, reported := -1, time.Now(), false
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-root.Done():
+				return
+			case <-t.C:
+			}
+			if root.AcceptingChildren() {
+				// Shutdown has not begun.
+				lastChange = time.Now()
+				continue
+			}
+			live := livePhasers(root)
+			if len(live) != last {
+				last, lastChange, reported = len(live), time.Now(), false
+				continue
+			}
+			if !reported && time.Since(lastChange) >= stallTimeout {
+				reported = true
+				report(live)
+			}
+		}
+	})
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stopCh) })
+	}
+}
@@ -0,0 +1,64 @@
+package phase
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	SetDebug(true)
+	defer SetDebug(false)
+
+	root := FromContext(context.Background(), WithName("root"))
+	web := root.Next(WithName("web"))
+	web.AutoClose()
+	// stuck never closes.
+	stuck := web.Next(WithName("stuck"))
+	root.Next(WithName("db")).AutoClose()
+
+	reports := make(chan []*Phaser, 1)
+	stop := StartWatchdog(root, 20*time.Millisecond, func(stalled []*Phaser) {
+		reports <- stalled
+	})
+	defer stop()
+	root.Cancel()
+
+	var stalled []*Phaser
+	select {
+	case stalled = <-reports:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the watchdog to report the stall")
+	}
+	var names []string
+	for _, p := range stalled {
+		names = append(names, p.Name())
+	}
+	if len(stalled) != 3 || stalled[0] != stuck {
+		t.Errorf("Expected stuck, web and root to be reported but got %v", names)
+	}
+	if !bytes.Contains(stalled[0].CreationStack(), []byte("TestWatchdog")) {
+		t.Errorf("Expected the creation stack of the stuck Phaser")
+	}
+
+	stuck.Cancel()
+	<-root.Done()
+}
+
+func TestWatchdogStallTimeout(t *testing.T) {
+	p0 := FromContext(context.Background())
+	defer p0.CancelAndWait()
+
+	// A timeout too short to divide still starts a watchdog.
+	stop := StartWatchdog(p0, 3, func([]*Phaser) {})
+	time.Sleep(time.Millisecond)
+	stop()
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a zero stall timeout to panic")
+		}
+	}()
+	StartWatchdog(p0, 0, func([]*Phaser) {})
+}